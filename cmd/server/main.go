@@ -1,77 +1,291 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"math/rand"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/alertmanager"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/api"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/cluster"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/dedup"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/dispatcher"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/health"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/history"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/inhibit"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/inventory"
 	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
 	"github.com/feifeigood/prometheus-zenaiop/pkg/service"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/silence"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/storm"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/tracing"
 	"github.com/feifeigood/prometheus-zenaiop/pkg/version"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/wal"
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check-config" {
+		os.Exit(checkConfig(os.Args[2:]))
+	}
+
 	rand.Seed(time.Now().UnixNano())
 	var (
 		printVersion = flag.Bool("version", false, "show program version")
+		configFile   = flag.String("config.file", "", "prometheus-zenaiop configuration file path")
 		listenAddr   = flag.String("web.listen-address", ":9299", "address on which the server will listen on")
+		adminToken   = flag.String("web.admin-token", "", "bearer token authorizes the admin endpoints under /-/ and creating or expiring silences, empty disables them")
 		logLevel     = flag.String("log.level", "debug", "log message output level")
-		webhookURL   = flag.String("aiop.webhook", "", "aiop webhook url")
+		logFormat    = flag.String("log.format", "console", "log message encoding, one of console or json")
+		logOutput    = flag.String("log.output", "stderr", "comma separated log outputs, stdout, stderr or file paths")
+		logMaxSize   = flag.Int("log.max-size", 0, "rotate log files larger than this number of megabytes, 0 disables size based rotation")
+		logRotate    = flag.Duration("log.rotate-interval", 0, "rotate log files older than this duration, 0 disables time based rotation")
+		logBackups   = flag.Int("log.max-backups", 7, "maximum number of rotated log files retained, 0 retains all of them")
+		logSampleIn  = flag.Int("log.sampling-initial", 100, "number of log messages with same level and message logged each second before sampling")
+		logSampleAft = flag.Int("log.sampling-thereafter", 100, "log every Nth message after sampling-initial each second, 0 disables sampling")
+		logFields    = logFieldsFlag{}
+		webhookURL   = flag.String("aiop.webhook", "", "aiop webhook url, used when no targets in config file")
+		schedule     = flag.String("aiop.schedule", "21:00-10:00", "daily local time range in which alerts are sent to aiop webhook")
+		rateLimit    = flag.Float64("aiop.rate-limit", 0, "sustained number of alerts per second sent to aiop webhook, 0 disables rate limiting")
+		rateBurst    = flag.Int("aiop.rate-burst", 50, "maximum number of alerts sent to aiop webhook at once")
+		queueCap     = flag.Int("queue.capacity", 1000, "maximum number of webhook messages waiting for delivery")
+		queueWorkers = flag.Int("queue.workers", 4, "number of workers converting and delivering webhook messages")
+		retryBackoff = flag.Duration("retry.backoff", 10*time.Second, "delay before the alerts a target failed to deliver with a retryable error are resent, doubled after each attempt")
+		retryMaxWait = flag.Duration("retry.max-backoff", 5*time.Minute, "maximum delay between the retries of failed alerts")
+		retryMax     = flag.Int("retry.max-attempts", 10, "number of retries before the failed alerts are dropped, 0 disables the retries")
+		retryMaxAge  = flag.Duration("retry.max-age", time.Hour, "how long after receipt the failed alerts are retried, 0 is unlimited")
+		dedupWindow  = flag.Duration("dedup.window", 2*time.Minute, "acknowledge without forwarding the webhook messages with same group key and alerts received within this duration, 0 disables deduplication")
+		queueHigh    = flag.Float64("queue.high-watermark", 0.8, "ratio of queue capacity above which the server is not ready")
+		healthWindow = flag.Duration("health.delivery-window", 10*time.Minute, "time window of deliveries the success rate of readiness is computed on")
+		healthRate   = flag.Float64("health.min-success-rate", 0.5, "minimum ratio of successful deliveries for the server to be ready")
+		healthMin    = flag.Int("health.min-deliveries", 5, "minimum number of deliveries in window before the success rate affects readiness")
+		stormLimit   = flag.Int("storm.threshold", 0, "collapse alerts into a summary alert when more than this number of them arrive within storm window, 0 disables aggregation")
+		stormWindow  = flag.Duration("storm.window", 5*time.Minute, "time window in which alerts are counted for storm aggregation")
+		stormGroupBy = flag.String("storm.group-by", "datacenter", "comma separated labels identify a storm together with alertname")
+		stormSamples = flag.Int("storm.samples", 5, "maximum number of affected address or domain listed in summary alert")
+		inhibitTTL   = flag.Duration("inhibit.state-ttl", 6*time.Hour, "how long a firing alert is tracked for inhibition without being notified again")
+		storagePath  = flag.String("storage.path", "data/", "base path for data storage")
+		walEnabled   = flag.Bool("wal.enabled", true, "write accepted webhook messages to a write-ahead log under storage path and replay them on startup")
+		walSegment   = flag.Int64("wal.segment-size", wal.DefaultSegmentSize, "size in bytes above which a new write-ahead log segment is started")
+		flapHoldDown = flag.Duration("flap.hold-down", 0, "delay RESOLVED alerts for this duration and cancel them if the alert fires again, 0 disables flap damping")
+		historySize  = flag.Int("history.size", 1000, "maximum number of alert history entries kept in memory")
+		clusterSelf  = flag.String("cluster.advertise-url", "", "url this replica is reached by its peers, e.g. http://10.0.0.1:9299, empty disables cluster mode")
+		clusterPeers = flag.String("cluster.peers", "", "comma separated urls of the other replicas")
+		clusterWait  = flag.Duration("cluster.peer-timeout", 15*time.Second, "time to wait for each peer ordered before this replica to send alerts")
+		clusterSync  = flag.Duration("cluster.sync-interval", 15*time.Second, "interval of full state exchange and liveness check with peers")
+		clusterKeep  = flag.Duration("cluster.retention", 24*time.Hour, "how long the sent status of an alert is remembered")
+		clusterToken = flag.String("cluster.token", "", "bearer token authorizes the state exchange between peers, required in cluster mode")
+		amFetch      = flag.Bool("alertmanager.fetch-truncated", false, "fetch the alerts truncated from webhook message by Alertmanager API")
+		amURL        = flag.String("alertmanager.url", "", "alertmanager url used to fetch truncated alerts, defaults to externalURL of webhook message")
+		traceURL     = flag.String("tracing.endpoint", "", "OTLP/HTTP traces url spans are exported to, e.g. http://localhost:4318/v1/traces, empty disables tracing")
+		traceService = flag.String("tracing.service-name", "prometheus-zenaiop", "service.name of exported spans")
 	)
 
+	flag.Var(logFields, "log.field", "static key=value field added to every log message, repeatable")
+
 	flag.Parse()
 
 	if *printVersion {
-		fmt.Println(version.VERSION)
+		fmt.Println(version.Print("prometheus-zenaiop"))
 		os.Exit(0)
 	}
 
-	if err := log.Init(log.Options{Level: *logLevel}); err != nil {
+	if err := log.Init(log.Options{
+		Level:       *logLevel,
+		Encoding:    *logFormat,
+		OutputPaths: strings.Split(*logOutput, ","),
+		Rotation: log.Rotation{
+			MaxSize:    *logMaxSize,
+			Interval:   *logRotate,
+			MaxBackups: *logBackups,
+		},
+		SamplingInitial:    *logSampleIn,
+		SamplingThereafter: *logSampleAft,
+		Fields:             logFields,
+	}); err != nil {
 		panic(err)
 	}
 
-	if _, err := url.ParseRequestURI(*webhookURL); err != nil {
+	zap.S().Infof("starting prometheus-zenaiop version %s revision %s branch %s build_date %s", version.VERSION, version.REVISION, version.BRANCH, version.BUILDDATE)
+
+	conf, err := config.LoadFile(*configFile)
+	if err != nil {
 		panic(err)
 	}
 
-	zap.S().Infof("starting prometheus-zenaiop version %s build_date %s", version.VERSION, version.BUILDDATE)
+	// without targets in config file, all alerts are sent to -aiop.webhook
+	if len(conf.Targets) == 0 {
+		if err := config.ValidateURL(*webhookURL); err != nil {
+			panic(err)
+		}
+		sched, err := config.ParseSchedule(*schedule)
+		if err != nil {
+			panic(err)
+		}
+
+		tc := config.DefaultTargetConfig
+		tc.Name, tc.URL, tc.Schedule = "default", *webhookURL, sched
+		if *rateLimit > 0 {
+			tc.RateLimit = &config.RateLimitConfig{Rate: *rateLimit, Burst: *rateBurst}
+		}
+		conf.Targets = []*config.TargetConfig{&tc}
+		conf.Route = &config.Route{Targets: []string{tc.Name}}
+	}
+
+	var tracer *tracing.Tracer
+	if *traceURL != "" {
+		tracer, err = tracing.New(tracing.Options{Endpoint: *traceURL, ServiceName: *traceService})
+		if err != nil {
+			panic(err)
+		}
+		tracing.SetTracer(tracer)
+	}
 
 	r := gin.New()
 	r.Use(ginzap.RecoveryWithZap(zap.L(), true))
-	r.Use(ginzap.Ginzap(zap.L(), time.RFC3339, true))
-
-	// creates Alertmanager webhook message converter chains
-	cvt := converter.New()
-	// build PostMessage service
-	svc := service.NewSimpleService(cvt, *webhookURL)
-
-	r.POST("/api/v1/zenlayer/aiop", func(c *gin.Context) {
-		var wm webhook.Message
-		if err := c.ShouldBindJSON(&wm); err != nil {
-			c.AbortWithError(http.StatusBadRequest, err)
-			return
-		}
+	r.Use(api.RequestID())
+	r.Use(func(c *gin.Context) {
+		// access log with the request ID of each request
+		ginzap.Ginzap(log.L(c.Request.Context()), time.RFC3339, true)(c)
+	})
 
-		if _, err := svc.Post(wm); err != nil {
-			c.AbortWithError(http.StatusInternalServerError, err)
-			return
+	var inv *inventory.Inventory
+	if conf.Enrichment != nil {
+		if inv, err = inventory.New(conf.Enrichment.File, conf.Enrichment.Keys); err != nil {
+			panic(err)
 		}
+		go inv.Run(time.Duration(conf.Enrichment.RefreshInterval), make(chan struct{}))
+	}
 
-		c.JSON(http.StatusOK, gin.H{
-			"status": "OK",
+	deliveries := health.NewDeliveries(*healthWindow)
+	hist := history.New(*historySize)
+	silences, err := silence.New(filepath.Join(*storagePath, "silences.json"))
+	if err != nil {
+		panic(err)
+	}
+	var am *alertmanager.Client
+	if *amFetch {
+		am = alertmanager.NewClient(*amURL, 10*time.Second)
+	}
+
+	var peers *cluster.Cluster
+	if *clusterSelf != "" {
+		// peers merge the pushed state, so anyone reaching the port could
+		// suppress alerts without a token
+		if *clusterToken == "" {
+			panic("-cluster.token is required in cluster mode")
+		}
+		peers = cluster.New(cluster.Options{
+			Self:         *clusterSelf,
+			Peers:        strings.Split(*clusterPeers, ","),
+			PeerTimeout:  *clusterWait,
+			SyncInterval: *clusterSync,
+			Retention:    *clusterKeep,
+			Token:        *clusterToken,
 		})
+		go peers.Run(make(chan struct{}))
+	}
+
+	// build PostMessage service, each target creates its own converter chains
+	svc, err := service.NewSimpleService(service.Options{
+		Targets:        conf.Targets,
+		Route:          conf.Route,
+		RelabelConfigs: conf.RelabelConfigs,
+		Storm: storm.Options{
+			Threshold: *stormLimit,
+			Window:    *stormWindow,
+			GroupBy:   strings.Split(*stormGroupBy, ","),
+			Samples:   *stormSamples,
+		},
+		History:      hist,
+		Alertmanager: am,
+		Silences:     silences,
+		Inhibitor:    inhibit.New(conf.InhibitRules, *inhibitTTL),
+		Inventory:    inv,
+		FlapHoldDown: *flapHoldDown,
+		Deliveries:   deliveries,
+		Cluster:      peers,
+		Retry: service.Retry{
+			Backoff:     *retryBackoff,
+			MaxBackoff:  *retryMaxWait,
+			MaxAttempts: *retryMax,
+			MaxAge:      *retryMaxAge,
+		},
 	})
+	if err != nil {
+		panic(err)
+	}
+
+	// accepted webhook messages survive restarts in the write-ahead log
+	var (
+		wl      *wal.WAL
+		pending []wal.Entry
+	)
+	if *walEnabled {
+		if wl, pending, err = wal.Open(filepath.Join(*storagePath, "wal"), *walSegment); err != nil {
+			panic(err)
+		}
+	}
+
+	// deliver webhook messages asynchronously
+	dsp := dispatcher.New(svc, dispatcher.Options{QueueCapacity: *queueCap, Workers: *queueWorkers, WAL: wl})
+	dsp.Run()
+	if len(pending) != 0 {
+		zap.S().Infof("replaying %d webhook messages from wal", len(pending))
+		dsp.Replay(pending)
+	}
+
+	liveness := health.NewChecker()
+	liveness.Add("dispatcher", func() (string, error) {
+		if dsp.Stopped() {
+			return "", errors.New("dispatcher is stopped")
+		}
+		return fmt.Sprintf("%d workers running", *queueWorkers), nil
+	})
+
+	readiness := health.NewChecker()
+	readiness.Add("config", func() (string, error) {
+		return fmt.Sprintf("%d targets loaded", len(conf.Targets)), nil
+	})
+	readiness.Add("queue", func() (string, error) {
+		msg := fmt.Sprintf("%d of %d messages queued", dsp.Len(), dsp.Cap())
+		if float64(dsp.Len()) >= *queueHigh*float64(dsp.Cap()) {
+			return "", fmt.Errorf("%s, above high-watermark %.2f", msg, *queueHigh)
+		}
+		return msg, nil
+	})
+	readiness.Add("delivery", deliveries.Check(*healthRate, *healthMin))
+
+	a := api.New(api.Options{
+		Queue:      dsp,
+		Dedup:      dedup.New(*dedupWindow),
+		History:    hist,
+		Silences:   silences,
+		AdminToken: *adminToken,
+		Liveness:   liveness,
+		Readiness:  readiness,
+	})
+	a.Register(r.Group("/api/v1"))
+	a.RegisterAdmin(r.Group("/-"))
+	a.RegisterHealth(r.Group("/-"))
+	if peers != nil {
+		peers.Register(r.Group("/api/v1"))
+	}
+
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -109,9 +323,71 @@ func main() {
 		select {
 		case <-term:
 			zap.S().Info("received SIGTERM, exiting gracefully...")
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := srv.Shutdown(ctx); err != nil {
+				zap.S().Errorf("error on shutting down the httpserver: %v", err)
+			}
+			cancel()
+			// drain the pending webhook messages
+			dsp.Stop()
+			if wl != nil {
+				if err := wl.Close(); err != nil {
+					zap.S().Errorf("error on closing the wal: %v", err)
+				}
+			}
+			if tracer != nil {
+				tracer.Shutdown()
+			}
 			os.Exit(0)
 		case <-srvc:
 			os.Exit(1)
 		}
 	}
 }
+
+// checkConfig validates the configuration files and reports all problems
+// found, it returns the exit code.
+func checkConfig(files []string) int {
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: prometheus-zenaiop check-config <file>...")
+		return 2
+	}
+
+	code := 0
+	for _, file := range files {
+		fmt.Printf("Checking %s\n", file)
+		errs := config.CheckFile(file)
+		if len(errs) == 0 {
+			fmt.Println("  SUCCESS")
+			continue
+		}
+
+		code = 1
+		fmt.Printf("  FAILED: %d problems found\n", len(errs))
+		for _, err := range errs {
+			fmt.Printf("  - %v\n", err)
+		}
+	}
+
+	return code
+}
+
+// logFieldsFlag collects the repeated -log.field flags.
+type logFieldsFlag map[string]string
+
+func (f logFieldsFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f logFieldsFlag) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("invalid log field %q, expected key=value", s)
+	}
+	f[kv[0]] = kv[1]
+	return nil
+}
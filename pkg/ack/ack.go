@@ -0,0 +1,65 @@
+// Package ack tracks the deliveries of a webhook message deferred past its
+// handling, e.g. the held down RESOLVED alerts or the failed deliveries
+// waiting for retry. The message is acknowledged once it was handled and all
+// of them completed.
+package ack
+
+import (
+	"context"
+	"sync"
+)
+
+// Tracker counts the pending deliveries of a webhook message.
+type Tracker struct {
+	mtx   sync.Mutex
+	holds int
+	done  func()
+}
+
+// New creates a Tracker calling done once the message was handled and all
+// the deferred deliveries completed.
+func New(done func()) *Tracker {
+	return &Tracker{holds: 1, done: done}
+}
+
+// Release completes the handling of message itself.
+func (t *Tracker) Release() {
+	t.release()
+}
+
+func (t *Tracker) release() {
+	t.mtx.Lock()
+	t.holds--
+	holds := t.holds
+	t.mtx.Unlock()
+
+	if holds == 0 {
+		t.done()
+	}
+}
+
+type trackerKey struct{}
+
+// NewContext returns a context carries the tracker.
+func NewContext(ctx context.Context, t *Tracker) context.Context {
+	return context.WithValue(ctx, trackerKey{}, t)
+}
+
+// Hold defers the acknowledgement of the message of ctx until the returned
+// function is called, whether the deferred delivery succeeded or was given
+// up. Calls after the first are ignored.
+func Hold(ctx context.Context) func() {
+	t, _ := ctx.Value(trackerKey{}).(*Tracker)
+	if t == nil {
+		return func() {}
+	}
+
+	t.mtx.Lock()
+	t.holds++
+	t.mtx.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(t.release)
+	}
+}
@@ -0,0 +1,28 @@
+package ack
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	var calls int
+	tr := New(func() { calls++ })
+	ctx := NewContext(context.Background(), tr)
+
+	first, second := Hold(ctx), Hold(ctx)
+	tr.Release()
+	first()
+	first()
+	if calls != 0 {
+		t.Fatal("expected message not acknowledged with pending deliveries")
+	}
+
+	second()
+	if calls != 1 {
+		t.Errorf("expected acknowledged once, but got %d calls", calls)
+	}
+
+	// no tracker in context
+	Hold(context.Background())()
+}
@@ -0,0 +1,149 @@
+package aiop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/tracing"
+	"github.com/go-resty/resty/v2"
+)
+
+// Response is the JSON body AIOP answers to the alerts posted. AIOP has no
+// published API contract, these are the fields the client understands, a
+// body without them is judged by the HTTP status alone.
+type Response struct {
+	// Success is false if AIOP refused the request
+	Success *bool `json:"success,omitempty"`
+	// Code is the AIOP error code, 0 is success
+	Code int `json:"code"`
+	// Message or Msg describes the error
+	Message string `json:"message,omitempty"`
+	Msg     string `json:"msg,omitempty"`
+	// Rejected are the alerts refused while the others were accepted
+	Rejected []Rejection `json:"rejected,omitempty"`
+}
+
+// Rejection is an alert AIOP refused.
+type Rejection struct {
+	ID     uint32 `json:"id"`
+	Code   int    `json:"code,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Result is the outcome of posting alerts to AIOP.
+type Result struct {
+	// StatusCode is the HTTP status code
+	StatusCode int
+	// Body is the raw response body
+	Body string
+	// Response is the parsed body, nil if the body is not JSON
+	Response *Response
+}
+
+// Error is a request AIOP failed or refused.
+type Error struct {
+	StatusCode int
+	Code       int
+	Message    string
+	// Retryable reports whether sending the same alerts again may succeed
+	Retryable bool
+}
+
+func (e *Error) Error() string {
+	kind := "permanent"
+	if e.Retryable {
+		kind = "retryable"
+	}
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s aiop error: %s", kind, e.Message)
+	}
+	return fmt.Sprintf("%s aiop error (status %d, code %d): %s", kind, e.StatusCode, e.Code, e.Message)
+}
+
+// Client posts alerts to an AIOP inter_alarm endpoint.
+type Client struct {
+	url    string
+	client *resty.Client
+}
+
+// NewClient creates a Client object.
+func NewClient(url string, timeout time.Duration, headers map[string]string) *Client {
+	return &Client{
+		url:    url,
+		client: resty.New().SetTimeout(timeout).SetHeaders(headers),
+	}
+}
+
+// Send posts {"alerts": alerts} to AIOP. A non-nil error is an *Error, the
+// request is refused as a whole by a non 2xx status, success false or a
+// non-zero code. The meaning of AIOP codes is unknown, so a request refused
+// by them is not retried. The alerts rejected individually are in the
+// result only.
+func (c *Client) Send(ctx context.Context, alerts converter.AIOPAlerts) (Result, error) {
+	req := c.client.R().SetContext(ctx).SetHeader("Content-Type", "application/json")
+	if id := log.RequestID(ctx); id != "" {
+		req.SetHeader(log.RequestIDHeader, id)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := req.SetBody(map[string]interface{}{"alerts": alerts}).Post(c.url)
+	if err != nil {
+		// connection errors and timeouts are transient
+		return Result{}, &Error{Message: err.Error(), Retryable: true}
+	}
+
+	res := Result{StatusCode: resp.StatusCode(), Body: string(resp.Body())}
+
+	var r Response
+	if err := json.Unmarshal(resp.Body(), &r); err == nil {
+		res.Response = &r
+	}
+
+	if !isSuccess(resp.StatusCode()) {
+		e := &Error{
+			StatusCode: resp.StatusCode(),
+			Message:    strings.TrimSpace(res.Body),
+			Retryable:  IsRetryableStatus(resp.StatusCode()),
+		}
+		if res.Response != nil {
+			e.Code, e.Message = r.Code, r.message(e.Message)
+		}
+		return res, e
+	}
+
+	if res.Response != nil && ((r.Success != nil && !*r.Success) || r.Code != 0) {
+		return res, &Error{
+			StatusCode: resp.StatusCode(),
+			Code:       r.Code,
+			Message:    r.message("request refused"),
+		}
+	}
+
+	return res, nil
+}
+
+func (r *Response) message(fallback string) string {
+	switch {
+	case r.Message != "":
+		return r.Message
+	case r.Msg != "":
+		return r.Msg
+	}
+	return fallback
+}
+
+func isSuccess(status int) bool {
+	return status/100 == 2
+}
+
+// IsRetryableStatus reports whether the HTTP status is transient, the other
+// 4xx are problems of the payload.
+func IsRetryableStatus(status int) bool {
+	return status/100 == 5 || status == http.StatusTooManyRequests || status == http.StatusRequestTimeout
+}
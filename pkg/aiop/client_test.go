@@ -0,0 +1,67 @@
+package aiop
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+)
+
+func TestClientSend(t *testing.T) {
+	alerts := converter.AIOPAlerts{{ID: 1, Status: "PROBLEM"}, {ID: 2, Status: "PROBLEM"}}
+
+	for _, tc := range []struct {
+		name      string
+		status    int
+		body      string
+		err       bool
+		retryable bool
+		rejected  int
+	}{
+		{name: "ok", status: 200, body: `{"code":0,"success":true}`},
+		{name: "plain text", status: 200, body: `ok`},
+		{name: "partial", status: 200, body: `{"code":0,"rejected":[{"id":2,"reason":"unknown device"}]}`, rejected: 1},
+		{name: "refused", status: 200, body: `{"success":false,"code":400,"msg":"invalid level"}`, err: true},
+		{name: "unknown code", status: 200, body: `{"code":503,"message":"busy"}`, err: true},
+		{name: "bad request", status: 400, body: `{"code":400,"message":"bad alerts"}`, err: true},
+		{name: "too many requests", status: 429, body: ``, err: true, retryable: true},
+		{name: "server error", status: 502, body: `bad gateway`, err: true, retryable: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			res, err := NewClient(srv.URL, time.Second, nil).Send(context.Background(), alerts)
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				var e *Error
+				if !errors.As(err, &e) || e.Retryable != tc.retryable {
+					t.Errorf("expected retryable %v, but got %v", tc.retryable, err)
+				}
+			}
+			if res.Response != nil && len(res.Response.Rejected) != tc.rejected {
+				t.Errorf("expected %d rejected alerts, but got %v", tc.rejected, res.Response.Rejected)
+			}
+		})
+	}
+}
+
+func TestClientUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	_, err := NewClient(srv.URL, time.Second, nil).Send(context.Background(), nil)
+	var e *Error
+	if !errors.As(err, &e) || !e.Retryable {
+		t.Errorf("expected retryable error, but got %v", err)
+	}
+}
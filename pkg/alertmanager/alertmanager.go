@@ -0,0 +1,77 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// Client queries alerts from Alertmanager API v2.
+type Client struct {
+	client *resty.Client
+	url    string
+}
+
+// NewClient creates a Client object, if url is empty the externalURL of
+// webhook message is used.
+func NewClient(url string, timeout time.Duration) *Client {
+	return &Client{client: resty.New().SetTimeout(timeout), url: url}
+}
+
+// gettableAlert is the subset of Alertmanager API v2 alert.
+type gettableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// GroupAlerts returns the active alerts of the receiver which match all of
+// the group labels.
+func (c *Client) GroupAlerts(ctx context.Context, externalURL, receiver string, groupLabels template.KV) (template.Alerts, error) {
+	url := c.url
+	if url == "" {
+		url = externalURL
+	}
+
+	req := c.client.R().SetContext(ctx).
+		SetQueryParam("active", "true").
+		SetQueryParam("silenced", "false").
+		SetQueryParam("inhibited", "false").
+		SetQueryParam("receiver", "^(?:"+regexp.QuoteMeta(receiver)+")$")
+	for _, pair := range groupLabels.SortedPairs() {
+		req.QueryParam.Add("filter", fmt.Sprintf("%s=%q", pair.Name, pair.Value))
+	}
+
+	var as []gettableAlert
+	resp, err := req.SetResult(&as).Get(strings.TrimRight(url, "/") + "/api/v2/alerts")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode(), resp.Body())
+	}
+
+	alerts := make(template.Alerts, 0, len(as))
+	for _, a := range as {
+		alerts = append(alerts, template.Alert{
+			Status:       "firing",
+			Labels:       a.Labels,
+			Annotations:  a.Annotations,
+			StartsAt:     a.StartsAt,
+			EndsAt:       a.EndsAt,
+			GeneratorURL: a.GeneratorURL,
+			Fingerprint:  a.Fingerprint,
+		})
+	}
+
+	return alerts, nil
+}
@@ -0,0 +1,53 @@
+package alertmanager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestGroupAlerts(t *testing.T) {
+	var query map[string][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/alerts" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"labels":{"alertname":"NodeDown","address":"10.0.0.1"},"fingerprint":"f1","startsAt":"2020-08-13T07:35:08Z"}]`))
+	}))
+	defer srv.Close()
+
+	c := NewClient("", time.Second)
+	alerts, err := c.GroupAlerts(context.Background(), srv.URL+"/", "aiop.sre+(ops)", template.KV{"alertname": "NodeDown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{`^(?:aiop\.sre\+\(ops\))$`}; !reflect.DeepEqual(want, query["receiver"]) {
+		t.Errorf("expected receiver %v, but got %v", want, query["receiver"])
+	}
+	if want := []string{`alertname="NodeDown"`}; !reflect.DeepEqual(want, query["filter"]) {
+		t.Errorf("expected filter %v, but got %v", want, query["filter"])
+	}
+	if len(alerts) != 1 || alerts[0].Status != "firing" || alerts[0].Fingerprint != "f1" || alerts[0].Labels["address"] != "10.0.0.1" {
+		t.Errorf("unexpected alerts %+v", alerts)
+	}
+}
+
+func TestGroupAlertsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if _, err := NewClient(srv.URL, time.Second).GroupAlerts(context.Background(), "", "aiop", nil); err == nil {
+		t.Error("expected error on unexpected status")
+	}
+}
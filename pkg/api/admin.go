@@ -0,0 +1,85 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type logLevel struct {
+	Level string `json:"level"`
+	// TTL reverts the level after the duration, e.g. 30m
+	TTL      string     `json:"ttl,omitempty"`
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// RegisterAdmin registers the admin handlers under the router, they require
+// the admin token.
+func (api *API) RegisterAdmin(r gin.IRouter) {
+	r = r.Group("", api.authorize)
+
+	r.GET("/log-level", api.getLogLevel)
+	r.PUT("/log-level", api.putLogLevel)
+}
+
+func (api *API) authorize(c *gin.Context) {
+	if api.opts.AdminToken == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints are disabled without admin token"})
+		return
+	}
+
+	token := []byte("Bearer " + api.opts.AdminToken)
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), token) != 1 {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+		return
+	}
+
+	c.Next()
+}
+
+func (api *API) getLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, currentLogLevel())
+}
+
+func (api *API) putLogLevel(c *gin.Context) {
+	var req logLevel
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(req.Level)); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	log.SetLevel(lvl, ttl)
+	zap.S().Infof("log level changed to %s by %s, ttl %s", lvl, c.ClientIP(), ttl)
+
+	c.JSON(http.StatusOK, currentLogLevel())
+}
+
+func currentLogLevel() logLevel {
+	lvl, at := log.Level()
+	res := logLevel{Level: lvl.String()}
+	if !at.IsZero() {
+		res.RevertAt = &at
+	}
+	return res
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/dedup"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/health"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/history"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/silence"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/version"
+	"github.com/gin-gonic/gin"
+)
+
+// Options for the creation of an API object.
+type Options struct {
+	// Queue accepts the webhook messages, nil disables the webhook handler
+	Queue Queue
+	// Dedup acknowledges duplicate webhook messages, nil disables it
+	Dedup    *dedup.Window
+	History  *history.History
+	Silences *silence.Silences
+	// AdminToken authorizes the admin endpoints and the changes of silences
+	// as bearer token, empty disables them
+	AdminToken string
+	// Liveness and Readiness are the checks of health endpoints
+	Liveness  *health.Checker
+	Readiness *health.Checker
+}
+
+// API provides the management REST endpoints.
+type API struct {
+	opts Options
+}
+
+// New creates an API object.
+func New(opts Options) *API {
+	return &API{opts: opts}
+}
+
+// Register registers the API handlers under the router.
+func (api *API) Register(r gin.IRouter) {
+	if api.opts.Queue != nil {
+		r.POST("/zenlayer/aiop", api.receiveWebhook)
+	}
+
+	r.GET("/status/buildinfo", api.buildInfo)
+
+	r.GET("/history", api.listHistory)
+
+	// silences mute alerts, so changing them requires the admin token
+	r.GET("/silences", api.listSilences)
+	r.POST("/silences", api.authorize, api.createSilence)
+	r.DELETE("/silence/:id", api.authorize, api.expireSilence)
+}
+
+func (api *API) buildInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, version.Info())
+}
+
+func (api *API) listHistory(c *gin.Context) {
+	c.JSON(http.StatusOK, api.opts.History.List())
+}
+
+func (api *API) listSilences(c *gin.Context) {
+	c.JSON(http.StatusOK, api.opts.Silences.List())
+}
+
+func (api *API) createSilence(c *gin.Context) {
+	var sil silence.Silence
+	if err := c.ShouldBindJSON(&sil); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := api.opts.Silences.Create(sil)
+	if errors.Is(err, silence.ErrPersist) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"silenceID": id})
+}
+
+func (api *API) expireSilence(c *gin.Context) {
+	err := api.opts.Silences.Expire(c.Param("id"))
+	if err == silence.ErrNotFound {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "OK"})
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/silence"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSilencesAuthorization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const body = `{"matchers":["datacenter=\"mumbai\""],"endsAt":"2999-01-01T00:00:00Z"}`
+
+	for _, tc := range []struct {
+		name   string
+		token  string
+		header string
+		code   int
+	}{
+		{name: "no token", token: "secret", code: http.StatusUnauthorized},
+		{name: "invalid token", token: "secret", header: "Bearer wrong", code: http.StatusUnauthorized},
+		{name: "disabled", header: "Bearer ", code: http.StatusForbidden},
+		{name: "authorized", token: "secret", header: "Bearer secret", code: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sil, err := silence.New(t.TempDir() + "/silences.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := gin.New()
+			New(Options{Silences: sil, AdminToken: tc.token}).Register(r)
+
+			serve := func(method, path, body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, strings.NewReader(body))
+				if tc.header != "" {
+					req.Header.Set("Authorization", tc.header)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				return w
+			}
+
+			if w := serve(http.MethodPost, "/silences", body); w.Code != tc.code {
+				t.Errorf("expected create answered %d, but got %d: %s", tc.code, w.Code, w.Body)
+			}
+			if tc.code == http.StatusOK && len(sil.List()) != 1 {
+				t.Errorf("expected silence created, but got %v", sil.List())
+			}
+			if tc.code != http.StatusOK && len(sil.List()) != 0 {
+				t.Errorf("expected no silence created, but got %v", sil.List())
+			}
+
+			// an unknown id is only looked up once authorized
+			code := tc.code
+			if code == http.StatusOK {
+				code = http.StatusNotFound
+			}
+			if w := serve(http.MethodDelete, "/silence/unknown", ""); w.Code != code {
+				t.Errorf("expected expire answered %d, but got %d: %s", code, w.Code, w.Body)
+			}
+		})
+	}
+}
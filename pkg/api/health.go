@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/health"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterHealth registers the liveness and readiness handlers under the
+// router, they answer 503 if any check fails.
+func (api *API) RegisterHealth(r gin.IRouter) {
+	r.GET("/healthy", checkHandler(api.opts.Liveness))
+	r.GET("/ready", checkHandler(api.opts.Readiness))
+}
+
+func checkHandler(c *health.Checker) gin.HandlerFunc {
+	if c == nil {
+		c = health.NewChecker()
+	}
+
+	return func(ctx *gin.Context) {
+		ok, res := c.Run()
+
+		status, code := health.StatusOK, http.StatusOK
+		if !ok {
+			status, code = health.StatusFailed, http.StatusServiceUnavailable
+		}
+
+		ctx.JSON(code, gin.H{"status": status, "checks": res})
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/health"
+	"github.com/gin-gonic/gin"
+)
+
+func TestHealthStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	failing := true
+	readiness := health.NewChecker()
+	readiness.Add("queue", func() (string, error) { return "10 of 1000 pending", nil })
+	readiness.Add("delivery", func() (string, error) {
+		if failing {
+			return "", errors.New("only 0% of 5 deliveries succeeded")
+		}
+		return "100% of 5 deliveries succeeded", nil
+	})
+
+	r := gin.New()
+	New(Options{Readiness: readiness}).RegisterHealth(r)
+
+	for _, tc := range []struct {
+		path    string
+		failing bool
+		code    int
+		status  string
+		checks  []health.Result
+	}{
+		{path: "/healthy", code: http.StatusOK, status: health.StatusOK, checks: []health.Result{}},
+		{path: "/ready", failing: true, code: http.StatusServiceUnavailable, status: health.StatusFailed, checks: []health.Result{
+			{Name: "queue", Status: health.StatusOK, Message: "10 of 1000 pending"},
+			{Name: "delivery", Status: health.StatusFailed, Message: "only 0% of 5 deliveries succeeded"},
+		}},
+		{path: "/ready", code: http.StatusOK, status: health.StatusOK, checks: []health.Result{
+			{Name: "queue", Status: health.StatusOK, Message: "10 of 1000 pending"},
+			{Name: "delivery", Status: health.StatusOK, Message: "100% of 5 deliveries succeeded"},
+		}},
+	} {
+		failing = tc.failing
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+		if w.Code != tc.code {
+			t.Fatalf("%s: expected %d, but got %d: %s", tc.path, tc.code, w.Code, w.Body)
+		}
+		var resp struct {
+			Status string          `json:"status"`
+			Checks []health.Result `json:"checks"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status != tc.status || len(resp.Checks) != len(tc.checks) {
+			t.Fatalf("%s: unexpected response %s", tc.path, w.Body)
+		}
+		for i, c := range tc.checks {
+			if resp.Checks[i] != c {
+				t.Errorf("%s: expected check %+v, but got %+v", tc.path, c, resp.Checks[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/gin-gonic/gin"
+)
+
+// maxRequestIDLength limits the length of request ID taken from header.
+const maxRequestIDLength = 128
+
+// RequestID is a middleware takes the request ID from X-Request-ID header or
+// generates one, the ID is added to the request context and echoed in the
+// response header.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(log.RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Request = c.Request.WithContext(log.WithRequestID(c.Request.Context(), id))
+		c.Header(log.RequestIDHeader, id)
+
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		// printable ASCII only, the ID is logged and sent as header
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
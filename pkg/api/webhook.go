@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/alertmanager/notify/webhook"
+)
+
+// Queue accepts the webhook messages for asynchronous delivery.
+type Queue interface {
+	Enqueue(context.Context, webhook.Message) error
+}
+
+// Status of webhook responses.
+const (
+	StatusAccepted    = "Accepted"
+	StatusDuplicate   = "Duplicate"
+	StatusRejected    = "Rejected"
+	StatusUnavailable = "Unavailable"
+)
+
+// StatusPolicy is the retry policy of webhook responses, Alertmanager only
+// retries on 5xx.
+const StatusPolicy = "2xx: the message is queued for delivery or was already received, " +
+	"transient delivery failures are retried by the server for the failed targets, do not retry; " +
+	"4xx: the message is invalid and will never be accepted, do not retry; " +
+	"5xx: the message could not be queued for now, retry later"
+
+// retryAfter is the Retry-After seconds of 5xx responses.
+const retryAfter = "30"
+
+// webhookResponse is the body of webhook responses.
+type webhookResponse struct {
+	Status    string `json:"status"`
+	RequestID string `json:"requestID"`
+	Error     string `json:"error,omitempty"`
+	// Retry tells whether the sender should send the message again
+	Retry  bool   `json:"retry"`
+	Policy string `json:"policy"`
+}
+
+// receiveWebhook validates the Alertmanager webhook message and queues it.
+func (api *API) receiveWebhook(c *gin.Context) {
+	ctx, span := tracing.Start(tracing.Extract(c.Request.Context(), c.Request.Header), "webhook.receive", tracing.WithKind(tracing.SpanKindServer))
+	defer span.End()
+
+	var wm webhook.Message
+	_, bind := tracing.Start(ctx, "webhook.bind")
+	err := c.ShouldBindJSON(&wm)
+	bind.SetError(err)
+	bind.End()
+	if err == nil {
+		err = validateMessage(wm)
+	}
+	if err != nil {
+		span.SetError(err)
+		api.respond(c, http.StatusBadRequest, StatusRejected, err)
+		return
+	}
+
+	// delivery outlives the request, only the request ID is carried on
+	ctx = tracing.ContextWithSpanContext(log.WithRequestID(context.Background(), log.RequestID(ctx)), span.Context())
+
+	// Alertmanager HA may deliver the same notification more than once
+	if api.opts.Dedup != nil && api.opts.Dedup.Seen(wm) {
+		log.S(ctx).Infof("duplicate webhook message(%s) acknowledged without forwarding", wm.GroupKey)
+		api.respond(c, http.StatusOK, StatusDuplicate, nil)
+		return
+	}
+
+	// a full queue or a failed write-ahead log is transient
+	if err := api.opts.Queue.Enqueue(ctx, wm); err != nil {
+		if api.opts.Dedup != nil {
+			api.opts.Dedup.Forget(wm)
+		}
+		span.SetError(err)
+		c.Header("Retry-After", retryAfter)
+		api.respond(c, http.StatusServiceUnavailable, StatusUnavailable, err)
+		return
+	}
+
+	api.respond(c, http.StatusAccepted, StatusAccepted, nil)
+}
+
+func (api *API) respond(c *gin.Context, code int, status string, err error) {
+	resp := webhookResponse{
+		Status:    status,
+		RequestID: log.RequestID(c.Request.Context()),
+		Retry:     code/100 == 5,
+		Policy:    StatusPolicy,
+	}
+	if err != nil {
+		// logged by the access log
+		c.Error(err)
+		resp.Error = err.Error()
+	}
+
+	c.JSON(code, resp)
+}
+
+// validateMessage returns the problem of message which will never be
+// delivered.
+func validateMessage(wm webhook.Message) error {
+	if wm.Data == nil || len(wm.Alerts) == 0 {
+		return errors.New("webhook message contains no alerts")
+	}
+
+	for i, a := range wm.Alerts {
+		if a.Status != "firing" && a.Status != "resolved" {
+			return fmt.Errorf("alert %d has invalid status %q", i, a.Status)
+		}
+		if len(a.Labels) == 0 {
+			return fmt.Errorf("alert %d has no labels", i)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/dedup"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/dispatcher"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/alertmanager/notify/webhook"
+)
+
+type fakeQueue struct {
+	err      error
+	messages []webhook.Message
+}
+
+func (q *fakeQueue) Enqueue(_ context.Context, wm webhook.Message) error {
+	if q.err != nil {
+		return q.err
+	}
+	q.messages = append(q.messages, wm)
+	return nil
+}
+
+func TestWebhookStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const valid = `{"status":"firing","groupKey":"g","alerts":[{"status":"firing","labels":{"alertname":"NodeDown"}}]}`
+
+	for _, tc := range []struct {
+		name     string
+		body     string
+		queueErr error
+		repeat   bool
+		code     int
+		status   string
+	}{
+		{name: "accepted", body: valid, code: http.StatusAccepted, status: StatusAccepted},
+		{name: "duplicate", body: valid, repeat: true, code: http.StatusOK, status: StatusDuplicate},
+		{name: "invalid json", body: `{"alerts":`, code: http.StatusBadRequest, status: StatusRejected},
+		{name: "no alerts", body: `{"status":"firing","alerts":[]}`, code: http.StatusBadRequest, status: StatusRejected},
+		{name: "invalid alert status", body: `{"alerts":[{"status":"pending","labels":{"alertname":"NodeDown"}}]}`, code: http.StatusBadRequest, status: StatusRejected},
+		{name: "no labels", body: `{"alerts":[{"status":"firing"}]}`, code: http.StatusBadRequest, status: StatusRejected},
+		{name: "queue full", body: valid, queueErr: dispatcher.ErrQueueFull, code: http.StatusServiceUnavailable, status: StatusUnavailable},
+		{name: "stopped", body: valid, queueErr: dispatcher.ErrStopped, code: http.StatusServiceUnavailable, status: StatusUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := gin.New()
+			New(Options{Queue: &fakeQueue{err: tc.queueErr}, Dedup: dedup.New(time.Minute)}).Register(r)
+
+			post := func() *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/zenlayer/aiop", strings.NewReader(tc.body)))
+				return w
+			}
+			w := post()
+			if tc.repeat {
+				w = post()
+			}
+
+			if w.Code != tc.code {
+				t.Fatalf("expected %d, but got %d: %s", tc.code, w.Code, w.Body)
+			}
+			var resp webhookResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tc.status || resp.Retry != (tc.code >= 500) || resp.Policy != StatusPolicy {
+				t.Errorf("unexpected response %+v", resp)
+			}
+			if retry := w.Header().Get("Retry-After"); (retry != "") != (tc.code >= 500) {
+				t.Errorf("unexpected Retry-After %q", retry)
+			}
+		})
+	}
+}
+
+func TestWebhookRetryAfterUnavailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	q := &fakeQueue{err: dispatcher.ErrQueueFull}
+	r := gin.New()
+	New(Options{Queue: q, Dedup: dedup.New(time.Minute)}).Register(r)
+
+	body := `{"groupKey":"g","alerts":[{"status":"firing","labels":{"alertname":"NodeDown"}}]}`
+	for _, code := range []int{http.StatusServiceUnavailable, http.StatusAccepted} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/zenlayer/aiop", strings.NewReader(body)))
+		if w.Code != code {
+			t.Fatalf("expected %d, but got %d", code, w.Code)
+		}
+		// the retry of Alertmanager is not taken as duplicate
+		q.err = nil
+	}
+	if len(q.messages) != 1 {
+		t.Errorf("expected retried message queued, but got %d", len(q.messages))
+	}
+}
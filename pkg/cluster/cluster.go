@@ -0,0 +1,442 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/ack"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var (
+	dedupedAlerts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "cluster",
+		Name:      "deduplicated_alerts_total",
+		Help:      "Total number of alerts not sent because a peer already sent them.",
+	}, []string{"target"})
+	alivePeers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "cluster",
+		Name:      "peers_alive",
+		Help:      "Number of peers answered the last state exchange.",
+	})
+	position = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "cluster",
+		Name:      "position",
+		Help:      "Position of this replica among the alive peers, 0 sends first.",
+	})
+	waitingAlerts = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "cluster",
+		Name:      "waiting_alerts",
+		Help:      "Number of alerts waiting for the peers ordered before this replica.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(dedupedAlerts, alivePeers, position, waitingAlerts)
+}
+
+// DeliverFunc sends the alerts whose turn came, the failures are retried by
+// it.
+type DeliverFunc func(context.Context, converter.AIOPAlerts)
+
+type receivedKey struct{}
+
+// WithReceived returns a context carries the time the webhook message was
+// received, the turn of replica is measured from it. The deliveries deferred
+// equally on all replicas, e.g. by flap hold-down, stamp their release.
+func WithReceived(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, receivedKey{}, t)
+}
+
+// Received returns the time the webhook message of ctx was received, now
+// if unknown.
+func Received(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(receivedKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// Options for the creation of a Cluster object.
+type Options struct {
+	// Self is the URL this replica is reached by its peers
+	Self string
+	// Peers are the URLs of the other replicas, Self is ignored
+	Peers []string
+	// PeerTimeout is how long a replica waits for each peer before it
+	// sends alerts
+	PeerTimeout time.Duration
+	// SyncInterval is the period of the full state exchange with peers
+	SyncInterval time.Duration
+	// Retention is how long the sent status of an alert is kept
+	Retention time.Duration
+	// Token authorizes the state exchange as bearer token, empty disables
+	// authorization and lets anyone reaching the port suppress alerts
+	Token string
+}
+
+// Entry is the last status of an AIOP alert sent to a target.
+type Entry struct {
+	Target    string    `json:"target"`
+	ID        uint32    `json:"id"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type entryKey struct {
+	target string
+	id     uint32
+}
+
+// Peer is the state of a peer.
+type Peer struct {
+	URL      string    `json:"url"`
+	Alive    bool      `json:"alive"`
+	LastSeen time.Time `json:"lastSeen,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Cluster deduplicates the alerts sent by replicas receiving the same
+// webhook messages. The replicas are ordered by URL, the one at position n
+// waits n peer timeouts before sending, and skips the alerts whose status a
+// peer already sent. A dead peer no longer counts for the position, so the
+// next replica takes over.
+type Cluster struct {
+	opts   Options
+	client *http.Client
+
+	mtx     sync.RWMutex
+	entries map[entryKey]Entry
+	peers   map[string]*Peer
+}
+
+// New creates a Cluster object, the peers are considered alive until the
+// first exchange with them fails.
+func New(opts Options) *Cluster {
+	if opts.PeerTimeout <= 0 {
+		opts.PeerTimeout = 15 * time.Second
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = 15 * time.Second
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = 24 * time.Hour
+	}
+
+	opts.Self = normalizeURL(opts.Self)
+
+	c := &Cluster{
+		opts:    opts,
+		client:  &http.Client{Timeout: opts.PeerTimeout},
+		entries: map[entryKey]Entry{},
+		peers:   map[string]*Peer{},
+	}
+	for _, url := range opts.Peers {
+		if url = normalizeURL(url); url != opts.Self && url != "" {
+			c.peers[url] = &Peer{URL: url, Alive: true}
+		}
+	}
+	c.updateMetrics()
+
+	return c
+}
+
+// Run exchanges the state with peers periodically until stopc is closed.
+func (c *Cluster) Run(stopc <-chan struct{}) {
+	ticker := time.NewTicker(c.opts.SyncInterval)
+	defer ticker.Stop()
+
+	c.sync()
+	for {
+		select {
+		case <-ticker.C:
+			c.gc()
+			c.sync()
+		case <-stopc:
+			return
+		}
+	}
+}
+
+// Position returns the number of alive peers ordered before this replica.
+func (c *Cluster) Position() int {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	var n int
+	for url, p := range c.peers {
+		if p.Alive && url < c.opts.Self {
+			n++
+		}
+	}
+	return n
+}
+
+// Filter returns the alerts whose status was not sent to target by any
+// replica yet if the turn of this replica came. The turn is measured from
+// the time the message was received, before it the alerts wait in a timer
+// and those still not sent by peers are delivered when it comes. The message
+// is not acknowledged while its alerts wait.
+func (c *Cluster) Filter(ctx context.Context, target string, alerts converter.AIOPAlerts, deliver DeliverFunc) converter.AIOPAlerts {
+	if c == nil || len(alerts) == 0 {
+		return alerts
+	}
+
+	wait := time.Until(Received(ctx).Add(time.Duration(c.Position()) * c.opts.PeerTimeout))
+	if wait <= 0 {
+		return c.filter(ctx, target, alerts)
+	}
+
+	log.S(ctx).Debugf("%d alerts of %s wait %s for peers", len(alerts), target, wait)
+	release := ack.Hold(ctx)
+	waitingAlerts.Add(float64(len(alerts)))
+	time.AfterFunc(wait, func() {
+		waitingAlerts.Sub(float64(len(alerts)))
+
+		if res := c.filter(ctx, target, alerts); len(res) != 0 {
+			deliver(ctx, res)
+		}
+		release()
+	})
+
+	return nil
+}
+
+// Unsent returns the alerts whose status was not sent to target by any
+// replica yet without waiting for the turn of this replica, e.g. when the
+// alerts are retried after their turn.
+func (c *Cluster) Unsent(ctx context.Context, target string, alerts converter.AIOPAlerts) converter.AIOPAlerts {
+	if c == nil {
+		return alerts
+	}
+	return c.filter(ctx, target, alerts)
+}
+
+func (c *Cluster) filter(ctx context.Context, target string, alerts converter.AIOPAlerts) converter.AIOPAlerts {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	res := make(converter.AIOPAlerts, 0, len(alerts))
+	for _, a := range alerts {
+		if e, ok := c.entries[entryKey{target, a.ID}]; ok && e.Status == a.Status {
+			log.S(ctx).Debugf("alerting %d(%s) already sent to %s by peer", a.ID, a.Status, target)
+			dedupedAlerts.WithLabelValues(target).Inc()
+			continue
+		}
+		res = append(res, a)
+	}
+
+	return res
+}
+
+// Record marks the alerts sent to target and pushes them to peers.
+func (c *Cluster) Record(ctx context.Context, target string, alerts converter.AIOPAlerts) {
+	if c == nil || len(alerts) == 0 {
+		return
+	}
+
+	now := time.Now()
+	entries := make([]Entry, 0, len(alerts))
+	for _, a := range alerts {
+		entries = append(entries, Entry{Target: target, ID: a.ID, Status: a.Status, Timestamp: now})
+	}
+	c.Merge(entries)
+
+	for _, url := range c.peerURLs() {
+		go func(url string) {
+			if err := c.push(url, entries); err != nil {
+				log.S(ctx).Warnf("failed to push %d entries to peer %s: %v", len(entries), url, err)
+			}
+		}(url)
+	}
+}
+
+// Merge adds the entries newer than the known ones.
+func (c *Cluster) Merge(entries []Entry) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, e := range entries {
+		k := entryKey{e.Target, e.ID}
+		if old, ok := c.entries[k]; !ok || e.Timestamp.After(old.Timestamp) {
+			c.entries[k] = e
+		}
+	}
+}
+
+// State returns all the entries.
+func (c *Cluster) State() []Entry {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	res := make([]Entry, 0, len(c.entries))
+	for _, e := range c.entries {
+		res = append(res, e)
+	}
+	return res
+}
+
+// Peers returns the state of peers ordered by URL.
+func (c *Cluster) Peers() []Peer {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	res := make([]Peer, 0, len(c.peers))
+	for _, p := range c.peers {
+		res = append(res, *p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].URL < res[j].URL })
+	return res
+}
+
+// sync pushes the full state to each peer and merges the state it answers.
+func (c *Cluster) sync() {
+	state := c.State()
+
+	var wg sync.WaitGroup
+	for _, url := range c.peerURLs() {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+
+			var (
+				resp []Entry
+				err  = c.exchange(url, state, &resp)
+			)
+			if err == nil {
+				c.Merge(resp)
+			}
+			c.setAlive(url, err)
+		}(url)
+	}
+	wg.Wait()
+
+	c.updateMetrics()
+}
+
+func (c *Cluster) push(url string, entries []Entry) error {
+	return c.exchange(url, entries, nil)
+}
+
+// exchange posts the entries to peer and decodes its state into resp if it
+// is not nil.
+func (c *Cluster) exchange(url string, entries []Entry, resp *[]Entry) error {
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	path := url + "/api/v1/cluster/state"
+	if resp != nil {
+		path += "?full=true"
+	}
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	if resp != nil {
+		return json.NewDecoder(res.Body).Decode(resp)
+	}
+	return nil
+}
+
+func (c *Cluster) setAlive(url string, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	p := c.peers[url]
+	if err != nil {
+		if p.Alive {
+			zap.S().Warnf("cluster peer %s is dead: %v", url, err)
+		}
+		p.Alive, p.Error = false, err.Error()
+		return
+	}
+
+	if !p.Alive {
+		zap.S().Infof("cluster peer %s is alive", url)
+	}
+	p.Alive, p.Error, p.LastSeen = true, "", time.Now()
+}
+
+// normalizeURL lowercases the scheme and host of u and removes the trailing
+// slash, so the replicas order the same URLs equally.
+func normalizeURL(u string) string {
+	u = strings.TrimSpace(u)
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return strings.TrimRight(u, "/")
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	parsed.Path = strings.TrimRight(parsed.Path, "/")
+	return parsed.String()
+}
+
+func (c *Cluster) peerURLs() []string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	res := make([]string, 0, len(c.peers))
+	for url := range c.peers {
+		res = append(res, url)
+	}
+	return res
+}
+
+// gc removes the entries older than retention.
+func (c *Cluster) gc() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.Sub(e.Timestamp) > c.opts.Retention {
+			delete(c.entries, k)
+		}
+	}
+}
+
+func (c *Cluster) updateMetrics() {
+	c.mtx.RLock()
+	var n int
+	for _, p := range c.peers {
+		if p.Alive {
+			n++
+		}
+	}
+	c.mtx.RUnlock()
+
+	alivePeers.Set(float64(n))
+	position.Set(float64(c.Position()))
+}
@@ -0,0 +1,154 @@
+package cluster
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/gin-gonic/gin"
+)
+
+// newPeers creates two replicas serving each other, the first one is
+// ordered before the second.
+func newPeers(t *testing.T) ([2]*Cluster, [2]*httptest.Server) {
+	gin.SetMode(gin.TestMode)
+
+	var (
+		clusters [2]*Cluster
+		servers  [2]*httptest.Server
+		engines  [2]*gin.Engine
+	)
+	for i := range servers {
+		engines[i] = gin.New()
+		servers[i] = httptest.NewServer(engines[i])
+	}
+	if servers[1].URL < servers[0].URL {
+		servers[0], servers[1] = servers[1], servers[0]
+		engines[0], engines[1] = engines[1], engines[0]
+	}
+
+	urls := []string{servers[0].URL, servers[1].URL}
+	for i := range clusters {
+		clusters[i] = New(Options{
+			Self:        urls[i],
+			Peers:       urls,
+			PeerTimeout: 50 * time.Millisecond,
+			Token:       "secret",
+		})
+		clusters[i].Register(engines[i].Group("/api/v1"))
+	}
+
+	return clusters, servers
+}
+
+func TestDeduplication(t *testing.T) {
+	clusters, servers := newPeers(t)
+	defer servers[0].Close()
+	defer servers[1].Close()
+
+	if clusters[0].Position() != 0 || clusters[1].Position() != 1 {
+		t.Fatalf("unexpected positions %d %d", clusters[0].Position(), clusters[1].Position())
+	}
+
+	alerts := converter.AIOPAlerts{{ID: 1, Status: "PROBLEM"}, {ID: 2, Status: "PROBLEM"}}
+	ctx := context.Background()
+
+	delivered := make(chan converter.AIOPAlerts, 1)
+	deliver := func(_ context.Context, alerts converter.AIOPAlerts) {
+		delivered <- alerts
+	}
+
+	sent := clusters[0].Filter(ctx, "SRE", alerts, deliver)
+	if len(sent) != 2 {
+		t.Fatalf("expected first replica sends all alerts, but got %v", sent)
+	}
+
+	// the second replica does not block while waiting for its turn
+	start := time.Now()
+	partial := converter.AIOPAlerts{alerts[0], {ID: 3, Status: "PROBLEM"}}
+	if res := clusters[1].Filter(WithReceived(ctx, start), "SRE", partial, deliver); len(res) != 0 {
+		t.Errorf("expected alerts waiting for peer, but got %v", res)
+	}
+	if time.Since(start) >= 50*time.Millisecond {
+		t.Errorf("expected second replica not blocked")
+	}
+	clusters[0].Record(ctx, "SRE", sent)
+
+	select {
+	case res := <-delivered:
+		if len(res) != 1 || res[0].ID != 3 {
+			t.Errorf("expected only alerts not sent by peer delivered, but got %v", res)
+		}
+		if time.Since(start) < 50*time.Millisecond {
+			t.Errorf("expected second replica waits for peer timeout")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected waiting alerts delivered")
+	}
+
+	// the turn passed since the message was received
+	received := WithReceived(ctx, time.Now().Add(-time.Second))
+	if res := clusters[1].Filter(received, "SRE", alerts, deliver); len(res) != 0 {
+		t.Errorf("expected alerts sent by peer skipped, but got %v", res)
+	}
+	// a status transition is sent again
+	resolved := converter.AIOPAlerts{{ID: 1, Status: "RESOLVED"}}
+	if res := clusters[1].Filter(received, "SRE", resolved, deliver); len(res) != 1 {
+		t.Errorf("expected resolved alert sent, but got %v", res)
+	}
+	// other targets are independent
+	if res := clusters[1].Filter(received, "CDN", alerts, deliver); len(res) != 2 {
+		t.Errorf("expected alerts of other target sent, but got %v", res)
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	c := New(Options{
+		Self:  "http://A:9299/",
+		Peers: []string{"http://a:9299", "HTTP://b:9299/", "http://c:9299"},
+	})
+
+	if peers := c.Peers(); len(peers) != 2 || peers[0].URL != "http://b:9299" {
+		t.Errorf("expected self excluded and peers normalized, but got %+v", peers)
+	}
+	if pos := c.Position(); pos != 0 {
+		t.Errorf("expected position 0, but got %d", pos)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	clusters, servers := newPeers(t)
+	defer servers[1].Close()
+
+	clusters[0].Record(context.Background(), "SRE", converter.AIOPAlerts{{ID: 1, Status: "PROBLEM"}})
+	clusters[1].sync()
+	if len(clusters[1].State()) != 1 {
+		t.Fatalf("expected state pulled from peer, but got %v", clusters[1].State())
+	}
+
+	servers[0].Close()
+	clusters[1].sync()
+
+	if pos := clusters[1].Position(); pos != 0 {
+		t.Errorf("expected second replica takes over position 0, but got %d", pos)
+	}
+	if peers := clusters[1].Peers(); len(peers) != 1 || peers[0].Alive {
+		t.Errorf("expected dead peer, but got %+v", peers)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	clusters, servers := newPeers(t)
+	defer servers[0].Close()
+	defer servers[1].Close()
+
+	c := New(Options{Self: "http://other", Peers: []string{servers[0].URL}, Token: "wrong"})
+	if err := c.push(servers[0].URL, []Entry{{Target: "SRE", ID: 1, Status: "PROBLEM"}}); err == nil {
+		t.Errorf("expected push with wrong token rejected")
+	}
+	if len(clusters[0].State()) != 0 {
+		t.Errorf("expected state unchanged, but got %v", clusters[0].State())
+	}
+}
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Register registers the peer handlers under the router.
+func (c *Cluster) Register(r gin.IRouter) {
+	r.GET("/cluster/status", c.status)
+	r.POST("/cluster/state", c.authorize, c.mergeState)
+}
+
+func (c *Cluster) authorize(ctx *gin.Context) {
+	if c.opts.Token == "" {
+		return
+	}
+
+	token := []byte("Bearer " + c.opts.Token)
+	if subtle.ConstantTimeCompare([]byte(ctx.GetHeader("Authorization")), token) != 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid cluster token"})
+	}
+}
+
+func (c *Cluster) status(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"self":     c.opts.Self,
+		"position": c.Position(),
+		"peers":    c.Peers(),
+	})
+}
+
+// mergeState merges the entries pushed by peer, the full state is answered
+// if asked for.
+func (c *Cluster) mergeState(ctx *gin.Context) {
+	var entries []Entry
+	if err := ctx.ShouldBindJSON(&entries); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Merge(entries)
+
+	if ctx.Query("full") == "true" {
+		ctx.JSON(http.StatusOK, c.State())
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CheckFile checks the given YAML file, see Check.
+func CheckFile(filename string) []error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return []error{err}
+	}
+	return Check(string(content))
+}
+
+// Check parses the configuration and returns all the problems found, unlike
+// Load which stops at the first one. Each top-level section of Config, and
+// each item of the list sections, is parsed on its own, then the problems
+// across sections are checked by the same validators as Load. A
+// configuration without problems is accepted by Load.
+func Check(s string) []error {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal([]byte(s), &raw); err != nil {
+		return []error{err}
+	}
+
+	var (
+		errs    []error
+		known   = map[string]bool{}
+		targets []string
+		route   *Route
+		routeOK = true
+	)
+	check := func(path string, v interface{}, typ reflect.Type) (interface{}, bool) {
+		out := reflect.New(typ)
+		if err := reparse(v, out.Interface()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			return nil, false
+		}
+		return out.Elem().Interface(), true
+	}
+
+	typ := reflect.TypeOf(Config{})
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		known[name] = true
+
+		v, ok := raw[name]
+		if !ok || v == nil {
+			continue
+		}
+
+		if f.Type.Kind() != reflect.Slice {
+			parsed, ok := check(name, v, f.Type)
+			if name == "route" {
+				route, routeOK = parsed.(*Route), ok
+			}
+			continue
+		}
+
+		items, ok := v.([]interface{})
+		if !ok {
+			check(name, v, f.Type)
+			continue
+		}
+		for j, item := range items {
+			path := fmt.Sprintf("%s[%d]", name, j)
+			if name == "targets" {
+				// a target with errors still counts as defined for routes
+				tn, _ := targetName(item)
+				targets = append(targets, tn)
+				if tn != "" {
+					path = fmt.Sprintf("%s(%s)", path, tn)
+				}
+			}
+			check(path, item, f.Type.Elem())
+		}
+	}
+
+	var unknown []string
+	for name := range raw {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, fmt.Errorf("field %s not found in config", name))
+	}
+
+	errs = append(errs, validateTargets(targets)...)
+	if routeOK {
+		errs = append(errs, validateRoute(targets, route)...)
+	}
+
+	// the problems found by Load only, if any, are reported as well
+	if len(errs) == 0 {
+		if _, err := Load(s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// reparse unmarshals the generic YAML value into out.
+func reparse(v interface{}, out interface{}) error {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(b, out)
+}
+
+func targetName(v interface{}) (string, bool) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return "", false
+	}
+	name, ok := m["name"].(string)
+	return name, ok && name != ""
+}
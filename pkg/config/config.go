@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/relabel"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the top-level configuration for prometheus-zenaiop's config files.
+type Config struct {
+	// RelabelConfigs are applied to the labels of each alert before conversion
+	RelabelConfigs []*relabel.Config `yaml:"relabel_configs,omitempty" json:"relabel_configs,omitempty"`
+	// InhibitRules hold target alerts back from AIOP while source alerts firing
+	InhibitRules []*config.InhibitRule `yaml:"inhibit_rules,omitempty" json:"inhibit_rules,omitempty"`
+	// Enrichment adds the missing labels from a local inventory file
+	Enrichment *EnrichmentConfig `yaml:"enrichment,omitempty" json:"enrichment,omitempty"`
+	// Targets are the named AIOP endpoints, defaults to -aiop.webhook if empty
+	Targets []*TargetConfig `yaml:"targets,omitempty" json:"targets,omitempty"`
+	// Route is the root of routing tree selects targets for alerts
+	Route *Route `yaml:"route,omitempty" json:"route,omitempty"`
+
+	// original is the input from which the config was parsed.
+	original string
+}
+
+func (c Config) String() string {
+	return c.original
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for Config.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(c.Targets))
+	for _, t := range c.Targets {
+		names = append(names, t.Name)
+	}
+
+	// shared with Check, which reports all of them
+	errs := append(validateTargets(names), validateRoute(names, c.Route)...)
+	if len(errs) != 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Load parses the YAML input s into a Config.
+func Load(s string) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict([]byte(s), cfg); err != nil {
+		return nil, err
+	}
+
+	cfg.original = s
+	return cfg, nil
+}
+
+// LoadFile parses the given YAML file into a Config, an empty filename
+// returns the default config.
+func LoadFile(filename string) (*Config, error) {
+	if filename == "" {
+		return Load("")
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := Load(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", filename, err)
+	}
+
+	return cfg, nil
+}
+
+// DefaultEnrichmentConfig is the default enrichment configuration.
+var DefaultEnrichmentConfig = EnrichmentConfig{
+	Keys:            []string{"address", "instance", "domain"},
+	RefreshInterval: model.Duration(time.Minute),
+}
+
+// EnrichmentConfig configures the labels enrichment from a local inventory
+// file in CSV, YAML or JSON format.
+type EnrichmentConfig struct {
+	File string `yaml:"file" json:"file"`
+	// Keys are the labels looked up in inventory in order
+	Keys []string `yaml:"keys,omitempty" json:"keys,omitempty"`
+	// RefreshInterval is how often the file is checked for changes
+	RefreshInterval model.Duration `yaml:"refresh_interval,omitempty" json:"refresh_interval,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for EnrichmentConfig.
+func (c *EnrichmentConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultEnrichmentConfig
+	type plain EnrichmentConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.File == "" {
+		return errors.New("missing file in enrichment config")
+	}
+	if len(c.Keys) == 0 {
+		return errors.New("missing keys in enrichment config")
+	}
+	if c.RefreshInterval <= 0 {
+		return errors.New("refresh_interval must be greater than 0 in enrichment config")
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFileExample(t *testing.T) {
+	if _, err := LoadFile("../../examples/config.yml"); err != nil {
+		t.Fatalf("failed to load example config: %v", err)
+	}
+}
+
+func TestLoadEmpty(t *testing.T) {
+	cfg, err := LoadFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.InhibitRules) != 0 || len(cfg.RelabelConfigs) != 0 || cfg.Enrichment != nil {
+		t.Errorf("expected empty config, but got %+v", cfg)
+	}
+}
+
+func TestScheduleActive(t *testing.T) {
+	sched, err := ParseSchedule("21:00-10:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		hour, minute int
+		active       bool
+	}{
+		{21, 0, true},
+		{23, 59, true},
+		{9, 59, true},
+		{10, 0, false},
+		{15, 30, false},
+	} {
+		tm := time.Date(2020, 8, 13, tc.hour, tc.minute, 0, 0, time.Local)
+		if sched.Active(tm) != tc.active {
+			t.Errorf("expected %s active %v", tm.Format("15:04"), tc.active)
+		}
+	}
+
+	var none *Schedule
+	if !none.Active(time.Now()) {
+		t.Error("expected nil schedule always active")
+	}
+}
+
+func TestLoadRouteErrors(t *testing.T) {
+	for _, yml := range []string{
+		"route:\n  targets: [SRE]\n",
+		"targets:\n- name: SRE\n  url: http://aiop/SRE\nroute:\n  targets: [NOC]\n",
+		"targets:\n- name: SRE\n  url: http://aiop/SRE\n- name: SRE\n  url: http://aiop/SRE\nroute:\n  targets: [SRE]\n",
+		"targets:\n- name: SRE\n  url: aiop\nroute:\n  targets: [SRE]\n",
+		"targets:\n- name: SRE\n  url: /inter_alarm\nroute:\n  targets: [SRE]\n",
+		"targets:\n- name: SRE\n  url: ftp://aiop/SRE\nroute:\n  targets: [SRE]\n",
+		"targets:\n- name: SRE\n  url: http://aiop/SRE\nroute:\n  targets: [SRE]\n  routes:\n  - match:\n      bad-label: x\n    targets: [SRE]\n",
+	} {
+		if _, err := Load(yml); err == nil {
+			t.Errorf("expected error for config %q", yml)
+		}
+	}
+}
+
+func TestLoadEnrichmentErrors(t *testing.T) {
+	for _, yml := range []string{
+		"enrichment:\n  keys: [address]\n",
+		"enrichment:\n  file: inventory.csv\n  refresh_interval: 0s\n",
+	} {
+		if _, err := Load(yml); err == nil {
+			t.Errorf("expected error for config %q", yml)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	errs := Check(`
+relabel_configs:
+- source_labels: [instance]
+  regex: '(.+'
+inhibit_rules:
+- source_match_re:
+    alertname: '['
+targets:
+- name: SRE
+  url: not a url
+- name: CDN
+  url: http://aiop/CDN
+  time:
+    time_zone: Mars/Olympus
+- name: CDN
+  url: http://aiop/CDN2
+route:
+  targets: [SRE]
+  routes:
+  - match:
+      bad-label: x
+    targets: [OPS]
+`)
+
+	want := []string{
+		"relabel_configs[0]",
+		"inhibit_rules[0]",
+		"targets[0](SRE): invalid url",
+		"targets[1](CDN): invalid time_zone",
+		"targets[2](CDN): target \"CDN\" is not unique",
+		"route.routes[0]: invalid label name \"bad-label\"",
+		"route.routes[0]: undefined target \"OPS\"",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, but got %v", len(want), errs)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(errs[i].Error(), prefix) {
+			t.Errorf("expected error with prefix %q, but got %q", prefix, errs[i])
+		}
+	}
+}
+
+func TestCheckMatchesLoad(t *testing.T) {
+	for _, yml := range []string{
+		"",
+		"targets:\n- name: SRE\n  url: http://aiop/SRE\nroute:\n  targets: [SRE]\n",
+		"targets:\n- name: SRE\n  url: http://aiop/SRE\n",
+		"unknown: true\n",
+		"enrichment:\n  file: inventory.csv\n  refresh_interval: 0s\n",
+	} {
+		_, err := Load(yml)
+		if errs := Check(yml); (err == nil) != (len(errs) == 0) {
+			t.Errorf("expected Check agrees with Load %v for config %q, but got %v", err, yml, errs)
+		}
+	}
+}
+
+func TestCheckExample(t *testing.T) {
+	if errs := CheckFile("../../examples/config.yml"); len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
@@ -0,0 +1,396 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/common/model"
+)
+
+// Target types
+const (
+	TargetAIOP    = "aiop"
+	TargetWebhook = "webhook"
+	TargetFile    = "file"
+	TargetEmail   = "email"
+)
+
+// DefaultTargetConfig is the default AIOP target configuration.
+var DefaultTargetConfig = TargetConfig{
+	Type:    TargetAIOP,
+	Time:    DefaultTimeConfig,
+	Message: DefaultMessageConfig,
+	Timeout: model.Duration(10 * time.Second),
+}
+
+// TargetConfig configures a named destination of alerts, by default an AIOP
+// inter_alarm endpoint.
+type TargetConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// Type is one of aiop, webhook, file or email
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	// URL of aiop and webhook targets
+	URL string `yaml:"url,omitempty" json:"url,omitempty"`
+	// Path of file target, alerts are appended as JSON lines
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Email configures the email target
+	Email *EmailConfig `yaml:"email,omitempty" json:"email,omitempty"`
+	// Schedule is the daily time range alerts are sent in, always if nil
+	Schedule *Schedule `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	// Time configures the time of alerts sent to the target
+	Time TimeConfig `yaml:"time,omitempty" json:"time,omitempty"`
+	// Message configures the message of alerts sent to the target
+	Message MessageConfig `yaml:"message,omitempty" json:"message,omitempty"`
+	// RateLimit throttles the alerts sent to the target, unlimited if nil
+	RateLimit *RateLimitConfig  `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+	Timeout   model.Duration    `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for TargetConfig.
+func (c *TargetConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultTargetConfig
+	type plain TargetConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.Name == "" {
+		return errors.New("missing name in target config")
+	}
+
+	switch c.Type {
+	case TargetAIOP, TargetWebhook:
+		if err := ValidateURL(c.URL); err != nil {
+			return fmt.Errorf("invalid url of target %q: %w", c.Name, err)
+		}
+	case TargetFile:
+		if c.Path == "" {
+			return fmt.Errorf("missing path of file target %q", c.Name)
+		}
+	case TargetEmail:
+		if c.Email == nil {
+			return fmt.Errorf("missing email config of target %q", c.Name)
+		}
+	default:
+		return fmt.Errorf("unknown type %q of target %q", c.Type, c.Name)
+	}
+
+	return nil
+}
+
+// DefaultEmailConfig is the default email target configuration.
+var DefaultEmailConfig = EmailConfig{
+	Subject: "[prometheus-zenaiop] alerts notification",
+}
+
+// EmailConfig configures an email target.
+type EmailConfig struct {
+	// Smarthost is the SMTP host:port through which emails are sent
+	Smarthost    string   `yaml:"smarthost" json:"smarthost"`
+	From         string   `yaml:"from" json:"from"`
+	To           []string `yaml:"to" json:"to"`
+	Subject      string   `yaml:"subject,omitempty" json:"subject,omitempty"`
+	AuthUsername string   `yaml:"auth_username,omitempty" json:"auth_username,omitempty"`
+	AuthPassword string   `yaml:"auth_password,omitempty" json:"-"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for EmailConfig.
+func (c *EmailConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultEmailConfig
+	type plain EmailConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if _, _, err := net.SplitHostPort(c.Smarthost); err != nil {
+		return fmt.Errorf("invalid email smarthost %q: %w", c.Smarthost, err)
+	}
+	if c.From == "" {
+		return errors.New("missing from address in email config")
+	}
+	if len(c.To) == 0 {
+		return errors.New("missing to addresses in email config")
+	}
+
+	return nil
+}
+
+// Resolved alerts time
+const (
+	ResolvedStartsAt = "starts_at"
+	ResolvedEndsAt   = "ends_at"
+)
+
+// DefaultTimeConfig is the default time configuration, the time looks like
+// 2020.08.07.15:22:12 in Asia/Shanghai.
+var DefaultTimeConfig = TimeConfig{
+	TimeZone:     "Asia/Shanghai",
+	Layout:       "2006.01.02.15:04:05",
+	ResolvedTime: ResolvedStartsAt,
+}
+
+// TimeConfig configures the time zone and layout of alert time.
+type TimeConfig struct {
+	TimeZone string `yaml:"time_zone,omitempty" json:"time_zone,omitempty"`
+	// Layout is the Go time layout, e.g. 2006.01.02 15:04:05
+	Layout string `yaml:"layout,omitempty" json:"layout,omitempty"`
+	// ResolvedTime is starts_at or ends_at, the time of resolved alerts
+	ResolvedTime string `yaml:"resolved_time,omitempty" json:"resolved_time,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for TimeConfig.
+func (c *TimeConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultTimeConfig
+	type plain TimeConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if _, err := converter.TimeIn(time.Now(), c.TimeZone); err != nil {
+		return fmt.Errorf("invalid time_zone: %w", err)
+	}
+	if c.Layout == "" {
+		return errors.New("missing time layout")
+	}
+	if c.ResolvedTime != ResolvedStartsAt && c.ResolvedTime != ResolvedEndsAt {
+		return fmt.Errorf("invalid resolved_time %q, expected %s or %s", c.ResolvedTime, ResolvedStartsAt, ResolvedEndsAt)
+	}
+
+	return nil
+}
+
+// DefaultMessageConfig is the default message configuration, the message
+// only contains alertname and description annotation.
+var DefaultMessageConfig = MessageConfig{
+	Annotations: []string{"description"},
+}
+
+// MessageConfig configures the fields of alert message.
+type MessageConfig struct {
+	// Annotations are looked up in order for the description
+	Annotations []string `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+	// Summary appends the summary annotation
+	Summary bool `yaml:"summary,omitempty" json:"summary,omitempty"`
+	// Labels are appended as name=value
+	Labels []string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	// GeneratorURL appends the link to the source of alert
+	GeneratorURL bool `yaml:"generator_url,omitempty" json:"generator_url,omitempty"`
+	// SilenceURL appends the Alertmanager link to silence the alert
+	SilenceURL bool `yaml:"silence_url,omitempty" json:"silence_url,omitempty"`
+	// MaxLength is the maximum bytes of message, zero means unlimited
+	MaxLength int `yaml:"max_length,omitempty" json:"max_length,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for MessageConfig.
+func (c *MessageConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultMessageConfig
+	type plain MessageConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if len(c.Annotations) == 0 {
+		return errors.New("missing description annotations in message config")
+	}
+	if c.MaxLength < 0 {
+		return errors.New("negative message max_length")
+	}
+
+	return nil
+}
+
+// RateLimitConfig configures a token bucket rate limiter.
+type RateLimitConfig struct {
+	// Rate is the sustained number of alerts per second
+	Rate float64 `yaml:"rate" json:"rate"`
+	// Burst is the maximum number of alerts sent at once
+	Burst int `yaml:"burst" json:"burst"`
+}
+
+// Schedule is a daily time range like 21:00-10:00, the range wraps around
+// midnight when start is after end.
+type Schedule struct {
+	Start    string `yaml:"start" json:"start"`
+	End      string `yaml:"end" json:"end"`
+	TimeZone string `yaml:"time_zone,omitempty" json:"time_zone,omitempty"`
+
+	start, end int
+	loc        *time.Location
+}
+
+// ParseSchedule parses a time range like 21:00-10:00 in local time.
+func ParseSchedule(s string) (*Schedule, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid schedule %q", s)
+	}
+
+	sched := &Schedule{Start: strings.TrimSpace(parts[0]), End: strings.TrimSpace(parts[1])}
+	return sched, sched.init()
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for Schedule.
+func (s *Schedule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Schedule
+	if err := unmarshal((*plain)(s)); err != nil {
+		return err
+	}
+	return s.init()
+}
+
+func (s *Schedule) init() (err error) {
+	if s.start, err = parseClock(s.Start); err != nil {
+		return err
+	}
+	if s.end, err = parseClock(s.End); err != nil {
+		return err
+	}
+
+	s.loc = time.Local
+	if s.TimeZone != "" {
+		if s.loc, err = time.LoadLocation(s.TimeZone); err != nil {
+			return fmt.Errorf("invalid schedule time_zone: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Active returns whether t is in the time range.
+func (s *Schedule) Active(t time.Time) bool {
+	if s == nil || s.start == s.end {
+		return true
+	}
+
+	t = t.In(s.loc)
+	m := t.Hour()*60 + t.Minute()
+	if s.start < s.end {
+		return m >= s.start && m < s.end
+	}
+	return m >= s.start || m < s.end
+}
+
+// parseClock returns the minutes of day of clock like 21:00.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schedule time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Route is a node of the routing tree selecting targets by labels, the
+// semantics follow Alertmanager route.
+type Route struct {
+	Targets  []string            `yaml:"targets,omitempty" json:"targets,omitempty"`
+	Match    map[string]string   `yaml:"match,omitempty" json:"match,omitempty"`
+	MatchRE  config.MatchRegexps `yaml:"match_re,omitempty" json:"match_re,omitempty"`
+	Continue bool                `yaml:"continue,omitempty" json:"continue,omitempty"`
+	Routes   []*Route            `yaml:"routes,omitempty" json:"routes,omitempty"`
+}
+
+// ValidateURL returns an error unless u is an absolute http or https URL.
+func ValidateURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q in %q", parsed.Scheme, u)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("missing host in %q", u)
+	}
+	return nil
+}
+
+// validateTargets returns the names defined more than once, names are the
+// target names in order, empty ones are ignored.
+func validateTargets(names []string) []error {
+	var (
+		errs []error
+		seen = map[string]bool{}
+	)
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			errs = append(errs, fmt.Errorf("targets[%d](%s): target %q is not unique", i, name, name))
+		}
+		seen[name] = true
+	}
+	return errs
+}
+
+// validateRoute returns the problems of routing tree, targets are the
+// defined target names.
+func validateRoute(targets []string, r *Route) []error {
+	if len(targets) == 0 {
+		if r != nil {
+			return []error{errors.New("route requires at least one target")}
+		}
+		return nil
+	}
+	if r == nil {
+		return []error{errors.New("no route provided in config")}
+	}
+
+	var errs []error
+	if len(r.Targets) == 0 {
+		errs = append(errs, errors.New("route: root route must specify a default target"))
+	}
+	if len(r.Match) > 0 || len(r.MatchRE) > 0 {
+		errs = append(errs, errors.New("route: root route must not have any matchers"))
+	}
+
+	defined := map[string]bool{}
+	for _, name := range targets {
+		defined[name] = true
+	}
+	return append(errs, validateRouteTree("route", r, defined)...)
+}
+
+// validateRouteTree returns the invalid matchers and undefined targets of
+// route and its children.
+func validateRouteTree(path string, r *Route, targets map[string]bool) []error {
+	var errs []error
+	var match, matchRE []string
+	for name := range r.Match {
+		match = append(match, name)
+	}
+	for name := range r.MatchRE {
+		matchRE = append(matchRE, name)
+	}
+	sort.Strings(match)
+	sort.Strings(matchRE)
+
+	for _, name := range match {
+		if !model.LabelName(name).IsValid() {
+			errs = append(errs, fmt.Errorf("%s: invalid label name %q in match", path, name))
+		}
+	}
+	for _, name := range matchRE {
+		if !model.LabelName(name).IsValid() {
+			errs = append(errs, fmt.Errorf("%s: invalid label name %q in match_re", path, name))
+		}
+	}
+	for _, name := range r.Targets {
+		if !targets[name] {
+			errs = append(errs, fmt.Errorf("%s: undefined target %q used in route", path, name))
+		}
+	}
+	for i, child := range r.Routes {
+		errs = append(errs, validateRouteTree(fmt.Sprintf("%s.routes[%d]", path, i), child, targets)...)
+	}
+
+	return errs
+}
@@ -1,8 +1,8 @@
 package converter
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"sort"
 	"strings"
 	"time"
@@ -27,7 +27,8 @@ type AIOPAlert struct {
 	Message string `json:"message"`
 	// Infor represents resource of report message
 	Infor string `json:"infor"`
-	// Time message startAt, date format is 2020.08.07 15:22:12
+	// Time message startAt, default format is 2020.08.07.15:22:12 in
+	// Asia/Shanghai, see TimeFormat
 	Time string `json:"time"`
 	// Status message current status  PROBLEM/RESOLVED
 	Status string `json:"status"`
@@ -35,21 +36,36 @@ type AIOPAlert struct {
 	Owner string `json:"owner"`
 }
 
-// Converter converts an alert manager webhook message to AIOP format
+// Converter converts an alert manager webhook message to AIOP format, the
+// context carries the request ID logged with the conversion.
 type Converter interface {
-	Convert(*AIOPAlerts, webhook.Message) error
+	Convert(context.Context, *AIOPAlerts, Message) error
 	SetNext(Converter)
 }
 
+// Options for the creation of a Converter object.
+type Options struct {
+	// TimeFormat formats the time of AIOP alerts
+	TimeFormat TimeFormat
+	// MessageFormat formats the message of AIOP alerts
+	MessageFormat MessageFormat
+}
+
+// DefaultOptions is the default converter options.
+var DefaultOptions = Options{
+	TimeFormat:    DefaultTimeFormat,
+	MessageFormat: DefaultMessageFormat,
+}
+
 // New creates a new Alertmanager webhook message converter object.
-func New() Converter {
+func New(opts Options) Converter {
 
 	unknow := &unknowAlert{}
 
-	biz := &bizAlert{}
+	biz := &bizAlert{opts: opts}
 	biz.SetNext(unknow)
 
-	node := &nodeAlert{}
+	node := &nodeAlert{opts: opts}
 	node.SetNext(biz)
 
 	return node
@@ -155,10 +171,64 @@ func FormatAIOPID(ls template.KV) uint32 {
 	return sum
 }
 
-// FormatAIOPTime format time to AIOP time
+// Alert is an alert of the webhook message with the state the bridge keeps
+// about it along the pipeline.
+type Alert struct {
+	template.Alert
+	// Enriched is the names of labels added by the inventory, they are left
+	// out of the AIOP ID
+	Enriched []string `json:"-"`
+}
+
+// Alerts a list of Alert
+type Alerts []Alert
+
+// NewAlerts wraps the alerts of a webhook message.
+func NewAlerts(as template.Alerts) Alerts {
+	res := make(Alerts, 0, len(as))
+	for _, a := range as {
+		res = append(res, Alert{Alert: a})
+	}
+	return res
+}
+
+// Template returns the Alertmanager alerts, e.g. to record in history.
+func (as Alerts) Template() template.Alerts {
+	res := make(template.Alerts, 0, len(as))
+	for _, a := range as {
+		res = append(res, a.Alert)
+	}
+	return res
+}
+
+// Message is a webhook message to convert, Alerts replaces the alerts of
+// the webhook data.
+type Message struct {
+	webhook.Message
+	Alerts Alerts
+}
+
+// AlertID returns the AIOP ID of alert from its labels except the enriched
+// ones, so the PROBLEM and RESOLVED of alert get the same ID when the
+// inventory changes in between.
+func AlertID(a Alert) uint32 {
+	if len(a.Enriched) == 0 {
+		return FormatAIOPID(a.Labels)
+	}
+
+	ls := make(template.KV, len(a.Labels))
+	for name, value := range a.Labels {
+		ls[name] = value
+	}
+	for _, name := range a.Enriched {
+		delete(ls, name)
+	}
+	return FormatAIOPID(ls)
+}
+
+// FormatAIOPTime format time to AIOP time with DefaultTimeFormat
 func FormatAIOPTime(t time.Time) string {
-	shanghai, _ := TimeIn(t, ShanghaiTZ)
-	return fmt.Sprintf("%d.%02d.%02d.%02d:%02d:%02d", shanghai.Year(), shanghai.Month(), shanghai.Day(), shanghai.Hour(), shanghai.Minute(), shanghai.Second())
+	return DefaultTimeFormat.Format(t)
 }
 
 // FormatAIOPLevel converts prometheus severity to aiop alerting level code
@@ -3,20 +3,109 @@ package converter
 import (
 	"testing"
 	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
 )
 
 func TestTimeIn(t *testing.T) {
-	for _, name := range []string{
-		"",
-		"Local",
-		"Asia/Shanghai",
-		"America/Metropolis",
+	for _, tc := range []struct {
+		name string
+		err  bool
+	}{
+		{name: ""},
+		{name: "Local"},
+		{name: "Asia/Shanghai"},
+		{name: "America/Metropolis", err: true},
 	} {
-		tm, err := TimeIn(time.Now(), name)
+		tm, err := TimeIn(time.Now(), tc.name)
+		if (err != nil) != tc.err {
+			t.Fatalf("TimeIn(%q) error = %v, want error %v", tc.name, err, tc.err)
+		}
 		if err == nil {
 			t.Logf("TimeIn => %s %s", tm.Location(), tm.Format("15:04"))
-		} else {
-			t.Logf("TimeIn => %s <time unknow>", name)
 		}
 	}
 }
+
+func TestFormatTruncatedAlert(t *testing.T) {
+	wm := webhook.Message{
+		Data: &template.Data{
+			Status:       "firing",
+			GroupLabels:  template.KV{"alertname": "NodeDown", "datacenter": "mumbai"},
+			CommonLabels: template.KV{"alertname": "NodeDown", "severity": "critical"},
+			ExternalURL:  "http://alertmanager-1:9093",
+		},
+		GroupKey:        "{}:{alertname=\"NodeDown\"}",
+		TruncatedAlerts: 12,
+	}
+
+	aa := FormatTruncatedAlert(wm, 12, DefaultTimeFormat)
+	if aa.Message != "[NodeDown] => 12 alerts truncated by Alertmanager, see http://alertmanager-1:9093" {
+		t.Errorf("unexpected message %q", aa.Message)
+	}
+	if aa.Infor != "ECN-CDN-TRUNCATED(alertname=NodeDown,datacenter=mumbai)" || aa.Level != 2 || aa.Status != "PROBLEM" {
+		t.Errorf("unexpected truncated alert %+v", aa)
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+	a := template.Alert{
+		Status:   "resolved",
+		StartsAt: time.Date(2020, 8, 13, 7, 35, 8, 0, time.UTC),
+		EndsAt:   time.Date(2020, 8, 13, 7, 37, 8, 0, time.UTC),
+	}
+
+	if s := DefaultTimeFormat.AlertTime(a); s != "2020.08.13.15:35:08" {
+		t.Errorf("unexpected default alert time %s", s)
+	}
+
+	f, err := NewTimeFormat("UTC", "2006.01.02 15:04:05", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := f.AlertTime(a); s != "2020.08.13 07:37:08" {
+		t.Errorf("unexpected resolved alert time %s", s)
+	}
+
+	a.Status = "firing"
+	if s := f.AlertTime(a); s != "2020.08.13 07:35:08" {
+		t.Errorf("unexpected firing alert time %s", s)
+	}
+
+	if _, err := NewTimeFormat("America/Metropolis", DefaultTimeLayout, false); err == nil {
+		t.Error("expected error for unknown time zone")
+	}
+}
+
+func TestMessageFormat(t *testing.T) {
+	a := template.Alert{
+		Labels:       template.KV{"alertname": "网卡进剧增", "address": "45.40.58.70", "device": "lan0"},
+		Annotations:  template.KV{"summary": "节点45.40.58.70网卡(lan0)进带宽剧增"},
+		GeneratorURL: "http://prometheus-1:9090/graph",
+	}
+
+	if m := DefaultMessageFormat.Message(a, ""); m != "[网卡进剧增] => " {
+		t.Errorf("unexpected default message %q", m)
+	}
+
+	f := MessageFormat{
+		Annotations:  []string{"description", "summary"},
+		Labels:       []string{"device", "datacenter"},
+		GeneratorURL: true,
+		SilenceURL:   true,
+	}
+	want := `[网卡进剧增] => 节点45.40.58.70网卡(lan0)进带宽剧增 | labels: device=lan0 | source: http://prometheus-1:9090/graph | silence: http://alertmanager-1:9093/#/silences/new?filter=%7Balertname%3D%22%E7%BD%91%E5%8D%A1%E8%BF%9B%E5%89%A7%E5%A2%9E%22%2Caddress%3D%2245.40.58.70%22%2Cdevice%3D%22lan0%22%7D`
+	if m := f.Message(a, "http://alertmanager-1:9093/"); m != want {
+		t.Errorf("expected %q, but got %q", want, m)
+	}
+
+	// the cut never splits a chinese character of 3 bytes
+	f = MessageFormat{MaxLength: 12}
+	if s := f.Truncate("[网卡进剧增]"); s != "[网卡..." {
+		t.Errorf("unexpected truncated message %q", s)
+	}
+	if s := f.Truncate("[NodeDown]"); s != "[NodeDown]" {
+		t.Errorf("unexpected short message %q", s)
+	}
+}
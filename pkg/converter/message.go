@@ -0,0 +1,92 @@
+package converter
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// DefaultMessageFormat only contains alertname and description annotation.
+var DefaultMessageFormat = MessageFormat{Annotations: []string{"description"}}
+
+// MessageFormat formats the message of AIOP alerts.
+type MessageFormat struct {
+	// Annotations are looked up in order, the first non-empty one is used
+	// as the description
+	Annotations []string
+	// Summary appends the summary annotation
+	Summary bool
+	// Labels are appended as name=value
+	Labels []string
+	// GeneratorURL appends the link to the source of alert
+	GeneratorURL bool
+	// SilenceURL appends the link to silence the alert in Alertmanager
+	SilenceURL bool
+	// MaxLength is the maximum bytes of message, zero means unlimited
+	MaxLength int
+}
+
+// Message formats the message of alert, externalURL is the Alertmanager url.
+func (f MessageFormat) Message(a template.Alert, externalURL string) string {
+	var desc string
+	for _, name := range f.Annotations {
+		if desc = a.Annotations[name]; desc != "" {
+			break
+		}
+	}
+
+	parts := []string{fmt.Sprintf("[%s] => %s", a.Labels["alertname"], desc)}
+	if f.Summary && a.Annotations["summary"] != "" {
+		parts = append(parts, "summary: "+a.Annotations["summary"])
+	}
+	if len(f.Labels) != 0 {
+		var ls []string
+		for _, name := range f.Labels {
+			if v, ok := a.Labels[name]; ok {
+				ls = append(ls, fmt.Sprintf("%s=%s", name, v))
+			}
+		}
+		if len(ls) != 0 {
+			parts = append(parts, "labels: "+strings.Join(ls, ", "))
+		}
+	}
+	if f.GeneratorURL && a.GeneratorURL != "" {
+		parts = append(parts, "source: "+a.GeneratorURL)
+	}
+	if f.SilenceURL && externalURL != "" {
+		parts = append(parts, "silence: "+SilenceURL(externalURL, a.Labels))
+	}
+
+	return f.Truncate(strings.Join(parts, " | "))
+}
+
+// Truncate cuts s to MaxLength bytes without splitting a multi-byte character.
+func (f MessageFormat) Truncate(s string) string {
+	const ellipsis = "..."
+	if f.MaxLength <= 0 || len(s) <= f.MaxLength {
+		return s
+	}
+	if f.MaxLength <= len(ellipsis) {
+		return ellipsis[:f.MaxLength]
+	}
+
+	n := f.MaxLength - len(ellipsis)
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + ellipsis
+}
+
+// SilenceURL returns the Alertmanager link to create a silence for labels.
+func SilenceURL(externalURL string, ls template.KV) string {
+	var matchers []string
+	for _, pair := range ls.SortedPairs() {
+		matchers = append(matchers, fmt.Sprintf("%s=%q", pair.Name, pair.Value))
+	}
+
+	filter := "{" + strings.Join(matchers, ",") + "}"
+	return strings.TrimRight(externalURL, "/") + "/#/silences/new?filter=" + url.QueryEscape(filter)
+}
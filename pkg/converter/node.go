@@ -1,64 +1,60 @@
 package converter
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
-	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/tracing"
 	"github.com/prometheus/alertmanager/template"
-	"go.uber.org/zap"
 )
 
 type nodeAlert struct {
 	next Converter
+	opts Options
 }
 
 func (na *nodeAlert) SetNext(next Converter) {
 	na.next = next
 }
 
-func (na *nodeAlert) Convert(alerts *AIOPAlerts, wm webhook.Message) error {
+func (na *nodeAlert) Convert(ctx context.Context, alerts *AIOPAlerts, wm Message) error {
 
 	if alerts == nil {
 		return errors.New("Alerting slice should not be nil")
 	}
 
-	as := template.Alerts{}
+	ctx, span := tracing.Start(ctx, "convert ECN-CDN-NODE")
+	defer span.End()
+	n := len(*alerts)
+
+	as := Alerts{}
 	for _, a := range wm.Alerts {
 		a := a
 		if !na.match(a.Labels) {
 			as = append(as, a)
 		} else {
-			zap.S().Debugf("Source alerting(ECN-CDN-NODE) =>  %s", outputJSON(a))
+			log.S(ctx).Debugf("Source alerting(ECN-CDN-NODE) =>  %s", outputJSON(a.Alert))
 			aa := AIOPAlert{
-				ID:      FormatAIOPID(a.Labels),
+				ID:      AlertID(a),
 				Type:    "ECN-CDN-NODE",
 				Level:   FormatAIOPLevel(a.Labels["severity"]),
-				Time:    FormatAIOPTime(a.StartsAt),
-				Message: fmt.Sprintf("[%s] => %s", a.Labels["alertname"], a.Annotations["description"]),
+				Time:    na.opts.TimeFormat.AlertTime(a.Alert),
+				Message: na.opts.MessageFormat.Message(a.Alert, wm.ExternalURL),
 				Infor:   fmt.Sprintf("ECN-CDN-NODE(%s)", a.Labels["address"]),
 				Status:  FormatAIOPStatus(a.Status),
 			}
-			zap.S().Debugf("Target alerting(ECN-CDN-NODE) =>  %s", outputJSON(aa))
+			log.S(ctx).Debugf("Target alerting(ECN-CDN-NODE) =>  %s", outputJSON(aa))
 			*alerts = append(*alerts, aa)
 		}
 	}
 
+	span.SetAttribute("alerts.received", len(wm.Alerts))
+	span.SetAttribute("alerts.converted", len(*alerts)-n)
+
 	if len(as) != 0 && na.next != nil {
-		return na.next.Convert(alerts, webhook.Message{
-			Data: &template.Data{
-				Receiver:          wm.Receiver,
-				Status:            wm.Status,
-				Alerts:            as,
-				GroupLabels:       wm.GroupLabels,
-				CommonLabels:      wm.CommonLabels,
-				CommonAnnotations: wm.CommonAnnotations,
-				ExternalURL:       wm.ExternalURL,
-			},
-			Version:         wm.Version,
-			GroupKey:        wm.GroupKey,
-			TruncatedAlerts: wm.TruncatedAlerts,
-		})
+		return na.next.Convert(ctx, alerts, Message{Message: wm.Message, Alerts: as})
 	}
 
 	return nil
@@ -0,0 +1,62 @@
+package converter
+
+import (
+	"time"
+	// the tz database is absent from minimal images, e.g. busybox, and the
+	// package loads Asia/Shanghai on init
+	_ "time/tzdata"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// DefaultTimeLayout is the layout of AIOP alert time, e.g. 2020.08.07.15:22:12
+const DefaultTimeLayout = "2006.01.02.15:04:05"
+
+// DefaultTimeFormat formats time with DefaultTimeLayout in Asia/Shanghai.
+var DefaultTimeFormat = TimeFormat{Location: mustLoadLocation(ShanghaiTZ), Layout: DefaultTimeLayout}
+
+// mustLoadLocation loads the time zone or panics, the package embeds the tz
+// database so it is available in any image.
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// TimeFormat formats the time of AIOP alerts.
+type TimeFormat struct {
+	Location *time.Location
+	// Layout is the Go time layout
+	Layout string
+	// ResolvedEndsAt uses EndsAt instead of StartsAt for resolved alerts
+	ResolvedEndsAt bool
+}
+
+// NewTimeFormat creates a TimeFormat in the named IANA time zone.
+func NewTimeFormat(timezone, layout string, resolvedEndsAt bool) (TimeFormat, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return TimeFormat{}, err
+	}
+
+	return TimeFormat{Location: loc, Layout: layout, ResolvedEndsAt: resolvedEndsAt}, nil
+}
+
+// Format formats t in the time zone.
+func (f TimeFormat) Format(t time.Time) string {
+	if f.Location != nil {
+		t = t.In(f.Location)
+	}
+	return t.Format(f.Layout)
+}
+
+// AlertTime formats the time the alert started, or ended if it is resolved
+// and ResolvedEndsAt is set.
+func (f TimeFormat) AlertTime(a template.Alert) string {
+	if f.ResolvedEndsAt && a.Status == "resolved" && !a.EndsAt.IsZero() {
+		return f.Format(a.EndsAt)
+	}
+	return f.Format(a.StartsAt)
+}
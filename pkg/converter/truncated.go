@@ -0,0 +1,29 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// FormatTruncatedAlert creates a synthetic AIOP alert reports the number of
+// alerts Alertmanager truncated from the group.
+func FormatTruncatedAlert(wm webhook.Message, truncated uint64, f TimeFormat) AIOPAlert {
+	var group []string
+	for _, name := range wm.GroupLabels.SortedPairs().Names() {
+		group = append(group, fmt.Sprintf("%s=%s", name, wm.GroupLabels[name]))
+	}
+
+	return AIOPAlert{
+		ID:      FormatAIOPID(template.KV{"groupKey": wm.GroupKey}),
+		Type:    "ECN-CDN-TRUNCATED",
+		Level:   FormatAIOPLevel(wm.CommonLabels["severity"]),
+		Time:    f.Format(time.Now()),
+		Message: fmt.Sprintf("[%s] => %d alerts truncated by Alertmanager, see %s", wm.GroupLabels["alertname"], truncated, wm.ExternalURL),
+		Infor:   fmt.Sprintf("ECN-CDN-TRUNCATED(%s)", strings.Join(group, ",")),
+		Status:  FormatAIOPStatus(wm.Status),
+	}
+}
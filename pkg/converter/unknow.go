@@ -1,11 +1,12 @@
 package converter
 
 import (
+	"context"
 	"errors"
 
-	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/tracing"
 	"github.com/prometheus/alertmanager/template"
-	"go.uber.org/zap"
 )
 
 type unknowAlert struct {
@@ -16,13 +17,17 @@ func (ua *unknowAlert) SetNext(next Converter) {
 	ua.next = next
 }
 
-func (ua *unknowAlert) Convert(alerts *AIOPAlerts, wm webhook.Message) error {
+func (ua *unknowAlert) Convert(ctx context.Context, alerts *AIOPAlerts, wm Message) error {
 	if alerts == nil {
 		return errors.New("Alerting slice should not be nil")
 	}
 
+	_, span := tracing.Start(ctx, "convert UNKNOW")
+	defer span.End()
+	span.SetAttribute("alerts.received", len(wm.Alerts))
+
 	for _, a := range wm.Alerts {
-		zap.S().Warnf("Unknow alerting(UNKNOW) =>  %s", outputJSON(a))
+		log.S(ctx).Warnf("Unknow alerting(UNKNOW) =>  %s", outputJSON(a.Alert))
 	}
 
 	return nil
@@ -0,0 +1,111 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var duplicates = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "prometheus_zenaiop",
+	Subsystem: "dedup",
+	Name:      "duplicate_messages_total",
+	Help:      "Total number of webhook messages acknowledged but not forwarded as duplicates.",
+})
+
+func init() {
+	prometheus.MustRegister(duplicates)
+}
+
+// Window remembers the webhook messages received within a duration, so the
+// same notification delivered again by Alertmanager HA is not forwarded.
+type Window struct {
+	window time.Duration
+
+	mtx  sync.Mutex
+	seen map[string]time.Time
+	// order holds the keys in arrival order, so expired ones are found
+	// without scanning seen
+	order []entry
+}
+
+type entry struct {
+	key string
+	at  time.Time
+}
+
+// New creates a Window object, a zero window disables deduplication.
+func New(window time.Duration) *Window {
+	return &Window{window: window, seen: map[string]time.Time{}}
+}
+
+// Seen reports whether the same message was received within the window,
+// otherwise the message is remembered.
+func (w *Window) Seen(wm webhook.Message) bool {
+	if w.window <= 0 {
+		return false
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	now := time.Now()
+	w.gc(now)
+
+	k := Key(wm)
+	if _, ok := w.seen[k]; ok {
+		duplicates.Inc()
+		return true
+	}
+	w.seen[k] = now
+	w.order = append(w.order, entry{key: k, at: now})
+
+	return false
+}
+
+// Forget removes the message, so it is forwarded when received again, e.g.
+// after it failed to be accepted.
+func (w *Window) Forget(wm webhook.Message) {
+	if w.window <= 0 {
+		return
+	}
+
+	w.mtx.Lock()
+	delete(w.seen, Key(wm))
+	w.mtx.Unlock()
+}
+
+// gc removes the messages out of window.
+func (w *Window) gc(now time.Time) {
+	var i int
+	for ; i < len(w.order) && now.Sub(w.order[i].at) > w.window; i++ {
+		// the key forgotten and seen again has a newer entry
+		if e := w.order[i]; w.seen[e.key].Equal(e.at) {
+			delete(w.seen, e.key)
+		}
+	}
+	w.order = w.order[i:]
+}
+
+// Key identifies a notification by GroupKey and the fingerprint, status and
+// start time of each alert.
+func Key(wm webhook.Message) string {
+	alerts := make([]string, 0, len(wm.Alerts))
+	for _, a := range wm.Alerts {
+		alerts = append(alerts, a.Fingerprint+"\xff"+a.Status+"\xff"+a.StartsAt.UTC().Format(time.RFC3339Nano))
+	}
+	sort.Strings(alerts)
+
+	h := sha256.New()
+	h.Write([]byte(wm.GroupKey))
+	for _, a := range alerts {
+		h.Write([]byte{0})
+		h.Write([]byte(a))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
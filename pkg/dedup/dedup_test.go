@@ -0,0 +1,79 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func message(status string, startsAt time.Time, fps ...string) webhook.Message {
+	wm := webhook.Message{Data: &template.Data{}, GroupKey: `{}:{alertname="NodeDown"}`}
+	for _, fp := range fps {
+		wm.Alerts = append(wm.Alerts, template.Alert{Fingerprint: fp, Status: status, StartsAt: startsAt})
+	}
+	return wm
+}
+
+func TestWindow(t *testing.T) {
+	var (
+		w   = New(50 * time.Millisecond)
+		now = time.Now()
+	)
+
+	if w.Seen(message("firing", now, "a", "b")) {
+		t.Fatalf("expected first message forwarded")
+	}
+	// the order of alerts does not matter
+	if !w.Seen(message("firing", now, "b", "a")) {
+		t.Errorf("expected duplicate message")
+	}
+
+	for _, wm := range []webhook.Message{
+		message("resolved", now, "a", "b"),
+		message("firing", now.Add(time.Second), "a", "b"),
+		message("firing", now, "a"),
+	} {
+		if w.Seen(wm) {
+			t.Errorf("expected different message forwarded %+v", wm.Alerts)
+		}
+	}
+
+	w.Forget(message("firing", now, "a"))
+	if w.Seen(message("firing", now, "a")) {
+		t.Errorf("expected forgotten message forwarded")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if w.Seen(message("firing", now, "a", "b")) {
+		t.Errorf("expected message forwarded after window")
+	}
+	if len(w.seen) != 1 || len(w.order) != 1 {
+		t.Errorf("expected expired messages removed, but got %d seen and %d ordered", len(w.seen), len(w.order))
+	}
+}
+
+func TestWindowForgetAndSeenAgain(t *testing.T) {
+	w := New(50 * time.Millisecond)
+	wm := message("firing", time.Now(), "a")
+
+	w.Seen(wm)
+	time.Sleep(30 * time.Millisecond)
+	w.Forget(wm)
+	w.Seen(wm)
+
+	// the entry before Forget expires but the message seen again does not
+	time.Sleep(30 * time.Millisecond)
+	if !w.Seen(wm) {
+		t.Errorf("expected duplicate of message seen again")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	w := New(0)
+	wm := message("firing", time.Now(), "a")
+	if w.Seen(wm) || w.Seen(wm) {
+		t.Errorf("expected no deduplication with zero window")
+	}
+}
@@ -0,0 +1,210 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/ack"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/cluster"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/service"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/wal"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrQueueFull is returned when the pending queue reached its capacity.
+	ErrQueueFull = errors.New("dispatcher queue is full")
+	// ErrStopped is returned when enqueue a message after dispatcher stopped.
+	ErrStopped = errors.New("dispatcher is stopped")
+)
+
+// Options for the creation of a Dispatcher object.
+type Options struct {
+	// QueueCapacity is the maximum number of pending webhook messages.
+	QueueCapacity int
+	// Workers is the number of goroutines converting and delivering messages.
+	Workers int
+	// WAL persists the accepted messages until delivered, nil disables it.
+	WAL *wal.WAL
+}
+
+// Dispatcher accepts Alertmanager webhook messages into a bounded queue and
+// delivers them asynchronously with a pool of workers.
+type Dispatcher struct {
+	svc   service.Service
+	opts  Options
+	queue chan item
+
+	mtx     sync.RWMutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// New creates a Dispatcher object.
+func New(svc service.Service, opts Options) *Dispatcher {
+	if opts.QueueCapacity <= 0 {
+		opts.QueueCapacity = 1
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+
+	return &Dispatcher{
+		svc:   svc,
+		opts:  opts,
+		queue: make(chan item, opts.QueueCapacity),
+	}
+}
+
+// Run starts the worker pool.
+func (d *Dispatcher) Run() {
+	for i := 0; i < d.opts.Workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+}
+
+// Enqueue adds a webhook message to the queue without blocking, it returns
+// ErrQueueFull if there is no room left. The context is used for delivery,
+// so it should not be canceled with the inbound request. The message is
+// written to WAL before Enqueue returns.
+func (d *Dispatcher) Enqueue(ctx context.Context, wm webhook.Message) error {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	if d.stopped {
+		return ErrStopped
+	}
+	if len(d.queue) >= cap(d.queue) {
+		return ErrQueueFull
+	}
+
+	received := time.Now()
+	it := item{ctx: cluster.WithReceived(ctx, received), wm: wm}
+	if d.opts.WAL != nil {
+		b, err := json.Marshal(walRecord{RequestID: log.RequestID(ctx), Received: received, Message: wm})
+		if err != nil {
+			return err
+		}
+		if it.walID, err = d.opts.WAL.Append(b); err != nil {
+			return fmt.Errorf("failed to write wal: %w", err)
+		}
+	}
+
+	select {
+	case d.queue <- it:
+		return nil
+	default:
+		d.done(it)
+		return ErrQueueFull
+	}
+}
+
+// Replay queues the messages left in WAL by previous run, it blocks until
+// all of them are queued, so the workers should be running. It should
+// return before new messages are accepted, otherwise a new RESOLVED may be
+// delivered ahead of the replayed PROBLEM.
+func (d *Dispatcher) Replay(entries []wal.Entry) {
+	for _, e := range entries {
+		var rec walRecord
+		if err := json.Unmarshal(e.Data, &rec); err != nil {
+			zap.S().Errorf("failed to decode wal entry %d, dropped: %v", e.ID, err)
+			d.opts.WAL.Done(e.ID)
+			continue
+		}
+
+		ctx := log.WithRequestID(context.Background(), rec.RequestID)
+		if !rec.Received.IsZero() {
+			ctx = cluster.WithReceived(ctx, rec.Received)
+		}
+		log.S(ctx).Infof("replaying webhook message(%s) from wal", rec.Message.GroupKey)
+
+		d.mtx.RLock()
+		if d.stopped {
+			d.mtx.RUnlock()
+			return
+		}
+		d.queue <- item{ctx: ctx, wm: rec.Message, walID: e.ID}
+		d.mtx.RUnlock()
+	}
+}
+
+// Len returns the number of pending webhook messages.
+func (d *Dispatcher) Len() int {
+	return len(d.queue)
+}
+
+// Cap returns the capacity of the queue.
+func (d *Dispatcher) Cap() int {
+	return cap(d.queue)
+}
+
+// Stopped reports whether the dispatcher stopped accepting messages.
+func (d *Dispatcher) Stopped() bool {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	return d.stopped
+}
+
+// Stop stops accepting new messages and waits until the pending messages
+// have been handled, the messages with deliveries still deferred, e.g.
+// waiting for retry, are left in WAL.
+func (d *Dispatcher) Stop() {
+	d.mtx.Lock()
+	if d.stopped {
+		d.mtx.Unlock()
+		return
+	}
+	d.stopped = true
+	close(d.queue)
+	d.mtx.Unlock()
+
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) worker() {
+	defer d.wg.Done()
+
+	for it := range d.queue {
+		it := it
+		// the deliveries deferred by service, e.g. the held down RESOLVED
+		// alerts or the failed ones waiting for retry, keep the message in
+		// WAL until they complete
+		tr := ack.New(func() { d.done(it) })
+
+		if _, err := d.svc.Post(ack.NewContext(it.ctx, tr), it.wm); err != nil {
+			log.S(it.ctx).Errorf("failed to deliver webhook message(%s): %v", it.wm.GroupKey, err)
+		}
+		tr.Release()
+	}
+}
+
+func (d *Dispatcher) done(it item) {
+	if it.walID == 0 {
+		return
+	}
+	if err := d.opts.WAL.Done(it.walID); err != nil {
+		log.S(it.ctx).Errorf("failed to mark webhook message(%s) done in wal: %v", it.wm.GroupKey, err)
+	}
+}
+
+// item is a queued webhook message with its context.
+type item struct {
+	ctx   context.Context
+	wm    webhook.Message
+	walID uint64
+}
+
+// walRecord is a webhook message in WAL.
+type walRecord struct {
+	RequestID string          `json:"requestID,omitempty"`
+	Received  time.Time       `json:"received,omitempty"`
+	Message   webhook.Message `json:"message"`
+}
@@ -0,0 +1,182 @@
+package dispatcher
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/ack"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/service"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/wal"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+type fakeService struct {
+	mtx   sync.Mutex
+	keys  []string
+	block chan struct{}
+	// hold defers a delivery of each message until release is called
+	hold     bool
+	release  func()
+	attempts int
+}
+
+func (s *fakeService) Post(ctx context.Context, wm webhook.Message) ([]service.PostResponse, error) {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.attempts++
+	if s.hold {
+		s.release = ack.Hold(ctx)
+	}
+	s.keys = append(s.keys, wm.GroupKey)
+	return nil, nil
+}
+
+func message(key string) webhook.Message {
+	return webhook.Message{Data: &template.Data{}, GroupKey: key}
+}
+
+func TestDispatcherQueueFull(t *testing.T) {
+	svc := &fakeService{}
+	d := New(svc, Options{QueueCapacity: 2, Workers: 1})
+
+	for _, key := range []string{"a", "b"} {
+		if err := d.Enqueue(context.Background(), message(key)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := d.Enqueue(context.Background(), message("c")); err != ErrQueueFull {
+		t.Fatalf("expected %v, but got %v", ErrQueueFull, err)
+	}
+
+	d.Run()
+	d.Stop()
+
+	if len(svc.keys) != 2 {
+		t.Errorf("expected 2 delivered messages, but got %v", svc.keys)
+	}
+
+	if err := d.Enqueue(context.Background(), message("d")); err != ErrStopped {
+		t.Errorf("expected %v, but got %v", ErrStopped, err)
+	}
+}
+
+func TestDispatcherDrainOnStop(t *testing.T) {
+	svc := &fakeService{block: make(chan struct{})}
+	d := New(svc, Options{QueueCapacity: 10, Workers: 3})
+	d.Run()
+
+	for i := 0; i < 10; i++ {
+		if err := d.Enqueue(context.Background(), message("x")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	close(svc.block)
+	d.Stop()
+
+	if len(svc.keys) != 10 {
+		t.Errorf("expected 10 delivered messages, but got %d", len(svc.keys))
+	}
+}
+
+func TestDispatcherWALReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	w, _, err := wal.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &fakeService{}
+	d := New(svc, Options{QueueCapacity: 10, Workers: 1, WAL: w})
+	for _, key := range []string{"a", "b"} {
+		if err := d.Enqueue(context.Background(), message(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// crash before the workers deliver anything
+	w.Close()
+
+	w, pending, err := wal.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending messages, but got %d", len(pending))
+	}
+
+	d = New(svc, Options{QueueCapacity: 1, Workers: 1, WAL: w})
+	d.Run()
+	d.Replay(pending)
+	d.Stop()
+	w.Close()
+
+	if want := []string{"a", "b"}; !reflect.DeepEqual(want, svc.keys) {
+		t.Errorf("expected %v replayed, but got %v", want, svc.keys)
+	}
+
+	_, pending, err = wal.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected delivered messages removed from wal, but got %d", len(pending))
+	}
+}
+
+func TestDispatcherDeferredKeptInWAL(t *testing.T) {
+	dir := t.TempDir()
+	w, _, err := wal.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &fakeService{hold: true}
+	d := New(svc, Options{QueueCapacity: 10, Workers: 1, WAL: w})
+	d.Run()
+	if err := d.Enqueue(context.Background(), message("a")); err != nil {
+		t.Fatal(err)
+	}
+	waitAttempts(t, svc, 1)
+	d.Stop()
+
+	pendingEntries := func() int {
+		_, pending, err := wal.Open(dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(pending)
+	}
+	// the delivery deferred by service, e.g. waiting for retry
+	if n := pendingEntries(); n != 1 {
+		t.Errorf("expected message with deferred delivery kept in wal, but got %d", n)
+	}
+
+	svc.release()
+	w.Close()
+	if n := pendingEntries(); n != 0 {
+		t.Errorf("expected message done in wal after deferred delivery, but got %d", n)
+	}
+}
+
+func waitAttempts(t *testing.T, svc *fakeService, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		svc.mtx.Lock()
+		attempts := svc.attempts
+		svc.mtx.Unlock()
+		if attempts >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d attempts before deadline", n)
+}
@@ -0,0 +1,137 @@
+package flap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/ack"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	pendingResolved = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "flap",
+		Name:      "pending_resolved",
+		Help:      "Number of RESOLVED alerts held down.",
+	})
+	flapsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "flap",
+		Name:      "flaps_total",
+		Help:      "Total number of held down RESOLVED alerts cancelled by firing again.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(pendingResolved, flapsTotal)
+}
+
+// DeliverFunc sends the alerts whose hold-down expired, the failures are
+// retried by it.
+type DeliverFunc func(context.Context, converter.AIOPAlerts)
+
+// Damper delays RESOLVED alerts for the hold-down period and cancels them
+// if the same alert fires again in between. The webhook message of a held
+// down alert is not acknowledged until it is delivered or cancelled, so it
+// is replayed from WAL after a restart.
+type Damper struct {
+	holdDown time.Duration
+	deliver  DeliverFunc
+
+	mtx     sync.Mutex
+	pending map[uint32]*held
+	flaps   map[uint32]int
+}
+
+// held is a RESOLVED alert waiting for its hold-down.
+type held struct {
+	timer   *time.Timer
+	release func()
+}
+
+// New creates a Damper object, a zero hold-down disables the damping.
+func New(holdDown time.Duration, deliver DeliverFunc) *Damper {
+	return &Damper{
+		holdDown: holdDown,
+		deliver:  deliver,
+		pending:  map[uint32]*held{},
+		flaps:    map[uint32]int{},
+	}
+}
+
+// Filter returns the alerts should be sent right now, RESOLVED alerts are
+// held down and delivered later with ctx.
+func (d *Damper) Filter(ctx context.Context, alerts converter.AIOPAlerts) converter.AIOPAlerts {
+	if d.holdDown <= 0 {
+		return alerts
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	res := converter.AIOPAlerts{}
+	for _, a := range alerts {
+		if a.Status == "RESOLVED" {
+			d.hold(ctx, a)
+			continue
+		}
+
+		if d.cancel(a.ID) {
+			flapsTotal.Inc()
+			d.flaps[a.ID]++
+		}
+		if n := d.flaps[a.ID]; n > 0 {
+			a.Message = fmt.Sprintf("%s (flapping %d times)", a.Message, n)
+		}
+		res = append(res, a)
+	}
+
+	return res
+}
+
+// hold schedules the delivery of RESOLVED alert after hold-down, the
+// previous pending one of same id is replaced.
+func (d *Damper) hold(ctx context.Context, a converter.AIOPAlert) {
+	d.cancel(a.ID)
+
+	h := &held{release: ack.Hold(ctx)}
+	h.timer = time.AfterFunc(d.holdDown, func() {
+		d.mtx.Lock()
+		// superseded or cancelled while the timer was firing
+		if d.pending[a.ID] != h {
+			d.mtx.Unlock()
+			return
+		}
+		if n := d.flaps[a.ID]; n > 0 {
+			a.Message = fmt.Sprintf("%s (flapping %d times)", a.Message, n)
+		}
+		delete(d.pending, a.ID)
+		delete(d.flaps, a.ID)
+		d.mtx.Unlock()
+
+		pendingResolved.Dec()
+		d.deliver(ctx, converter.AIOPAlerts{a})
+		h.release()
+	})
+	d.pending[a.ID] = h
+	pendingResolved.Inc()
+}
+
+// cancel stops the pending RESOLVED alert of id, it reports whether there
+// was one.
+func (d *Damper) cancel(id uint32) bool {
+	h, ok := d.pending[id]
+	if !ok {
+		return false
+	}
+
+	h.timer.Stop()
+	h.release()
+	delete(d.pending, id)
+	pendingResolved.Dec()
+	return true
+}
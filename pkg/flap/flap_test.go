@@ -0,0 +1,100 @@
+package flap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/ack"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+)
+
+func TestDamper(t *testing.T) {
+	delivered := make(chan converter.AIOPAlerts, 1)
+	d := New(50*time.Millisecond, func(_ context.Context, alerts converter.AIOPAlerts) {
+		delivered <- alerts
+	})
+
+	problem := converter.AIOPAlert{ID: 1, Message: "[NodeDown] => down", Status: "PROBLEM"}
+	resolved := converter.AIOPAlert{ID: 1, Message: "[NodeDown] => down", Status: "RESOLVED"}
+
+	if res := d.Filter(context.Background(), converter.AIOPAlerts{problem}); len(res) != 1 || res[0].Message != problem.Message {
+		t.Fatalf("expected PROBLEM passed through, but got %v", res)
+	}
+
+	// firing again within hold-down cancels the RESOLVED
+	if res := d.Filter(context.Background(), converter.AIOPAlerts{resolved}); len(res) != 0 {
+		t.Fatalf("expected RESOLVED held down, but got %v", res)
+	}
+	res := d.Filter(context.Background(), converter.AIOPAlerts{problem})
+	if len(res) != 1 || res[0].Message != "[NodeDown] => down (flapping 1 times)" {
+		t.Fatalf("expected flapping PROBLEM, but got %v", res)
+	}
+
+	d.Filter(context.Background(), converter.AIOPAlerts{resolved})
+	select {
+	case alerts := <-delivered:
+		if len(alerts) != 1 || alerts[0].Status != "RESOLVED" || alerts[0].Message != "[NodeDown] => down (flapping 1 times)" {
+			t.Errorf("unexpected delivered alerts %v", alerts)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected RESOLVED delivered after hold-down")
+	}
+
+	if res := d.Filter(context.Background(), converter.AIOPAlerts{problem}); res[0].Message != problem.Message {
+		t.Errorf("expected flap count reset, but got %v", res)
+	}
+}
+
+func TestDamperDisabled(t *testing.T) {
+	d := New(0, nil)
+
+	resolved := converter.AIOPAlert{ID: 1, Status: "RESOLVED"}
+	if res := d.Filter(context.Background(), converter.AIOPAlerts{resolved}); len(res) != 1 {
+		t.Errorf("expected RESOLVED passed through, but got %v", res)
+	}
+}
+
+func TestDamperAcknowledgement(t *testing.T) {
+	var (
+		acked     = make(chan struct{}, 1)
+		delivered = make(chan struct{}, 1)
+	)
+	d := New(10*time.Millisecond, func(context.Context, converter.AIOPAlerts) {
+		delivered <- struct{}{}
+	})
+
+	handle := func(alerts converter.AIOPAlerts) {
+		tr := ack.New(func() { acked <- struct{}{} })
+		d.Filter(ack.NewContext(context.Background(), tr), alerts)
+		tr.Release()
+	}
+
+	resolved := converter.AIOPAlert{ID: 1, Status: "RESOLVED"}
+	handle(converter.AIOPAlerts{resolved})
+	select {
+	case <-acked:
+		t.Fatal("expected message not acknowledged during hold-down")
+	case <-time.After(5 * time.Millisecond):
+	}
+	<-acked
+	select {
+	case <-delivered:
+	default:
+		t.Error("expected message acknowledged after RESOLVED delivered")
+	}
+
+	// cancelled by firing again
+	handle(converter.AIOPAlerts{resolved})
+	d.Filter(context.Background(), converter.AIOPAlerts{{ID: 1, Status: "PROBLEM"}})
+	select {
+	case <-acked:
+	case <-time.After(time.Second):
+		t.Error("expected cancelled RESOLVED acknowledged")
+	}
+	select {
+	case <-delivered:
+		t.Error("expected cancelled RESOLVED not delivered")
+	default:
+	}
+}
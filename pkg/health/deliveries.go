@@ -0,0 +1,81 @@
+package health
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Deliveries tracks the outcome of recent deliveries within a window.
+type Deliveries struct {
+	window time.Duration
+
+	mtx      sync.Mutex
+	outcomes []outcome
+}
+
+type outcome struct {
+	at      time.Time
+	success bool
+}
+
+// NewDeliveries creates a Deliveries object keeps the outcomes of window.
+func NewDeliveries(window time.Duration) *Deliveries {
+	return &Deliveries{window: window}
+}
+
+// Observe records the outcome of a delivery.
+func (d *Deliveries) Observe(success bool) {
+	if d == nil {
+		return
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	now := time.Now()
+	d.gc(now)
+	d.outcomes = append(d.outcomes, outcome{at: now, success: success})
+}
+
+// SuccessRate returns the ratio of successful deliveries within window and
+// the number of deliveries.
+func (d *Deliveries) SuccessRate() (float64, int) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.gc(time.Now())
+	if len(d.outcomes) == 0 {
+		return 1, 0
+	}
+
+	var n int
+	for _, o := range d.outcomes {
+		if o.success {
+			n++
+		}
+	}
+	return float64(n) / float64(len(d.outcomes)), len(d.outcomes)
+}
+
+// Check returns a CheckFunc fails when the success rate of at least
+// minSamples deliveries falls below minRate.
+func (d *Deliveries) Check(minRate float64, minSamples int) CheckFunc {
+	return func() (string, error) {
+		rate, total := d.SuccessRate()
+		msg := fmt.Sprintf("%.0f%% of %d deliveries succeeded in last %s", rate*100, total, d.window)
+		if total >= minSamples && rate < minRate {
+			return "", fmt.Errorf("only %s", msg)
+		}
+		return msg, nil
+	}
+}
+
+// gc removes the outcomes out of window.
+func (d *Deliveries) gc(now time.Time) {
+	var i int
+	for i < len(d.outcomes) && now.Sub(d.outcomes[i].at) > d.window {
+		i++
+	}
+	d.outcomes = d.outcomes[i:]
+}
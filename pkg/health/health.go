@@ -0,0 +1,68 @@
+package health
+
+import (
+	"sync"
+)
+
+// Status of a check.
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// CheckFunc checks a component, it returns a nil error if the component is
+// healthy, the message describes the state either way.
+type CheckFunc func() (message string, err error)
+
+// Result is the outcome of a check.
+type Result struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Checker runs a list of named checks.
+type Checker struct {
+	mtx    sync.RWMutex
+	names  []string
+	checks map[string]CheckFunc
+}
+
+// NewChecker creates a Checker object.
+func NewChecker() *Checker {
+	return &Checker{checks: map[string]CheckFunc{}}
+}
+
+// Add adds a check, a check with the same name is replaced.
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = fn
+}
+
+// Run runs the checks in the order added, it reports whether all of them
+// passed.
+func (c *Checker) Run() (bool, []Result) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	var (
+		healthy = true
+		res     = make([]Result, 0, len(c.names))
+	)
+	for _, name := range c.names {
+		msg, err := c.checks[name]()
+		r := Result{Name: name, Status: StatusOK, Message: msg}
+		if err != nil {
+			healthy = false
+			r.Status, r.Message = StatusFailed, err.Error()
+		}
+		res = append(res, r)
+	}
+
+	return healthy, res
+}
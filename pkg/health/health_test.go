@@ -0,0 +1,51 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	c := NewChecker()
+	c.Add("config", func() (string, error) { return "loaded", nil })
+	c.Add("queue", func() (string, error) { return "", errors.New("queue is full") })
+
+	ok, res := c.Run()
+	if ok {
+		t.Errorf("expected failed checks")
+	}
+	want := []Result{
+		{Name: "config", Status: StatusOK, Message: "loaded"},
+		{Name: "queue", Status: StatusFailed, Message: "queue is full"},
+	}
+	for i := range want {
+		if res[i] != want[i] {
+			t.Errorf("expected %+v, but got %+v", want[i], res[i])
+		}
+	}
+}
+
+func TestDeliveries(t *testing.T) {
+	d := NewDeliveries(50 * time.Millisecond)
+	check := d.Check(0.5, 3)
+
+	d.Observe(false)
+	d.Observe(false)
+	if _, err := check(); err != nil {
+		t.Errorf("expected passed below min samples, but got %v", err)
+	}
+
+	d.Observe(true)
+	if rate, total := d.SuccessRate(); total != 3 || rate >= 0.5 {
+		t.Errorf("unexpected success rate %f of %d", rate, total)
+	}
+	if _, err := check(); err == nil {
+		t.Errorf("expected failed with low success rate")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, total := d.SuccessRate(); total != 0 {
+		t.Errorf("expected outcomes expired, but got %d", total)
+	}
+}
@@ -0,0 +1,67 @@
+package history
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// Entry records an alert which was not forwarded to AIOP as is.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Action is what happened to the alert, e.g. aggregated
+	Action string `json:"action"`
+	// Reason refers to the object caused the action, e.g. summary alert id
+	Reason string         `json:"reason,omitempty"`
+	Alert  template.Alert `json:"alert"`
+}
+
+// History keeps the latest entries in memory.
+type History struct {
+	mtx     sync.RWMutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+// New creates a History object holding at most size entries.
+func New(size int) *History {
+	if size <= 0 {
+		size = 1
+	}
+	return &History{entries: make([]Entry, size)}
+}
+
+// Add records an alert with the action and reason.
+func (h *History) Add(action, reason string, alerts ...template.Alert) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	now := time.Now()
+	for _, a := range alerts {
+		h.entries[h.next] = Entry{Time: now, Action: action, Reason: reason, Alert: a}
+		h.next = (h.next + 1) % len(h.entries)
+		if h.next == 0 {
+			h.full = true
+		}
+	}
+}
+
+// List returns entries from newest to oldest.
+func (h *History) List() []Entry {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	n := h.next
+	if h.full {
+		n = len(h.entries)
+	}
+
+	res := make([]Entry, 0, n)
+	for i := 1; i <= n; i++ {
+		res = append(res, h.entries[(h.next-i+len(h.entries))%len(h.entries)])
+	}
+
+	return res
+}
@@ -0,0 +1,50 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+func alert(fp string) template.Alert {
+	return template.Alert{Fingerprint: fp}
+}
+
+func fingerprints(entries []Entry) []string {
+	res := make([]string, 0, len(entries))
+	for _, e := range entries {
+		res = append(res, e.Alert.Fingerprint)
+	}
+	return res
+}
+
+func TestHistory(t *testing.T) {
+	h := New(3)
+	if entries := h.List(); len(entries) != 0 {
+		t.Fatalf("expected empty history, but got %v", entries)
+	}
+
+	h.Add("silenced", "s1", alert("a"), alert("b"))
+	if want := []string{"b", "a"}; !reflect.DeepEqual(want, fingerprints(h.List())) {
+		t.Errorf("expected newest first %v, but got %v", want, fingerprints(h.List()))
+	}
+
+	// the oldest entries are evicted at capacity
+	h.Add("inhibited", "fp", alert("c"), alert("d"))
+	entries := h.List()
+	if want := []string{"d", "c", "b"}; !reflect.DeepEqual(want, fingerprints(entries)) {
+		t.Errorf("expected %v, but got %v", want, fingerprints(entries))
+	}
+	if entries[0].Action != "inhibited" || entries[0].Reason != "fp" || entries[2].Action != "silenced" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
+
+func TestHistoryMinimumSize(t *testing.T) {
+	h := New(0)
+	h.Add("dropped", "relabel", alert("a"), alert("b"))
+	if want := []string{"b"}; !reflect.DeepEqual(want, fingerprints(h.List())) {
+		t.Errorf("expected %v, but got %v", want, fingerprints(h.List()))
+	}
+}
@@ -0,0 +1,102 @@
+package inhibit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// Inhibitor tracks the firing alerts and holds back the target alerts of
+// inhibit rules while a source alert is firing.
+type Inhibitor struct {
+	rules []*config.InhibitRule
+	// ttl is how long a firing alert is tracked without notification
+	ttl time.Duration
+
+	mtx    sync.RWMutex
+	firing map[string]firingAlert
+}
+
+type firingAlert struct {
+	labels    template.KV
+	updatedAt time.Time
+}
+
+// New creates an Inhibitor object.
+func New(rules []*config.InhibitRule, ttl time.Duration) *Inhibitor {
+	return &Inhibitor{rules: rules, ttl: ttl, firing: map[string]firingAlert{}}
+}
+
+// Update records the firing state of alerts.
+func (ih *Inhibitor) Update(alerts template.Alerts) {
+	if len(ih.rules) == 0 {
+		return
+	}
+
+	ih.mtx.Lock()
+	defer ih.mtx.Unlock()
+
+	now := time.Now()
+	for fp, a := range ih.firing {
+		if ih.ttl > 0 && now.Sub(a.updatedAt) > ih.ttl {
+			delete(ih.firing, fp)
+		}
+	}
+
+	for _, a := range alerts {
+		if a.Status == "firing" {
+			ih.firing[a.Fingerprint] = firingAlert{labels: a.Labels, updatedAt: now}
+		} else {
+			delete(ih.firing, a.Fingerprint)
+		}
+	}
+}
+
+// Mutes returns the fingerprint of the firing source alert which inhibits
+// the alert.
+func (ih *Inhibitor) Mutes(a template.Alert) (string, bool) {
+	ih.mtx.RLock()
+	defer ih.mtx.RUnlock()
+
+	for _, r := range ih.rules {
+		if !matches(a.Labels, r.TargetMatch, r.TargetMatchRE) {
+			continue
+		}
+
+		for fp, src := range ih.firing {
+			if fp == a.Fingerprint || !matches(src.labels, r.SourceMatch, r.SourceMatchRE) {
+				continue
+			}
+			if equal(a.Labels, src.labels, r) {
+				return fp, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func matches(ls template.KV, match map[string]string, matchRE config.MatchRegexps) bool {
+	for name, value := range match {
+		if ls[name] != value {
+			return false
+		}
+	}
+	for name, re := range matchRE {
+		if !re.MatchString(ls[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equal(target, source template.KV, r *config.InhibitRule) bool {
+	for _, name := range r.Equal {
+		if target[string(name)] != source[string(name)] {
+			return false
+		}
+	}
+	return true
+}
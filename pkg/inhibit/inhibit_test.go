@@ -0,0 +1,51 @@
+package inhibit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func alert(fp, status string, ls template.KV) template.Alert {
+	return template.Alert{Fingerprint: fp, Status: status, Labels: ls}
+}
+
+func TestInhibitor(t *testing.T) {
+	cfg, err := config.Load(`
+inhibit_rules:
+- source_match:
+    alertname: DatacenterDown
+  target_match_re:
+    alertname: ECN-CDN-NODE|NodeDown
+  equal: [datacenter]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ih := New(cfg.InhibitRules, time.Hour)
+	src := alert("dc", "firing", template.KV{"alertname": "DatacenterDown", "datacenter": "mumbai"})
+	ih.Update(template.Alerts{src})
+
+	for _, tc := range []struct {
+		alert template.Alert
+		muted bool
+	}{
+		{alert("n1", "firing", template.KV{"alertname": "NodeDown", "datacenter": "mumbai"}), true},
+		{alert("n2", "firing", template.KV{"alertname": "NodeDown", "datacenter": "lax"}), false},
+		{alert("n3", "firing", template.KV{"alertname": "DiskFull", "datacenter": "mumbai"}), false},
+		{src, false},
+	} {
+		if fp, muted := ih.Mutes(tc.alert); muted != tc.muted {
+			t.Errorf("expected %s muted %v, but got %v(%s)", tc.alert.Fingerprint, tc.muted, muted, fp)
+		}
+	}
+
+	src.Status = "resolved"
+	ih.Update(template.Alerts{src})
+	if _, muted := ih.Mutes(alert("n1", "firing", template.KV{"alertname": "NodeDown", "datacenter": "mumbai"})); muted {
+		t.Error("expected alert not muted after source resolved")
+	}
+}
@@ -0,0 +1,224 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	lookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "inventory",
+		Name:      "lookups_total",
+		Help:      "Total number of inventory lookups by result.",
+	}, []string{"result"})
+	entries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "inventory",
+		Name:      "entries",
+		Help:      "Number of entries in the loaded inventory.",
+	})
+	reloadFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "inventory",
+		Name:      "reload_failures_total",
+		Help:      "Total number of failed inventory reloads.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(lookups, entries, reloadFailures)
+}
+
+// Inventory adds the missing labels of alerts from a local inventory file.
+type Inventory struct {
+	file string
+	keys []string
+
+	mtx     sync.RWMutex
+	index   map[string]map[string]map[string]string
+	modTime time.Time
+}
+
+// New creates an Inventory object and loads the file, records are indexed
+// by the values of keys labels.
+func New(file string, keys []string) (*Inventory, error) {
+	inv := &Inventory{file: file, keys: keys}
+	if _, err := inv.reload(); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Run reloads the inventory file every interval when it changed until stop
+// is closed.
+func (inv *Inventory) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := inv.reload()
+			if err != nil {
+				reloadFailures.Inc()
+				zap.S().Errorf("failed to reload inventory %s: %v", inv.file, err)
+			} else if reloaded {
+				zap.S().Infof("inventory %s reloaded", inv.file)
+			}
+		}
+	}
+}
+
+// Enrich returns the alerts with the labels missing from alert added, the
+// labels present in alert are never overwritten. The added label names are
+// recorded in the Enriched of alert.
+func (inv *Inventory) Enrich(alerts template.Alerts) converter.Alerts {
+	inv.mtx.RLock()
+	defer inv.mtx.RUnlock()
+
+	res := make(converter.Alerts, 0, len(alerts))
+	for _, a := range alerts {
+		record, ok := inv.lookup(a.Labels)
+		if !ok {
+			lookups.WithLabelValues("miss").Inc()
+			res = append(res, converter.Alert{Alert: a})
+			continue
+		}
+
+		lookups.WithLabelValues("hit").Inc()
+		var (
+			ls    = make(template.KV, len(a.Labels)+len(record))
+			added []string
+		)
+		for name, value := range a.Labels {
+			ls[name] = value
+		}
+		for name, value := range record {
+			if _, ok := ls[name]; !ok {
+				ls[name] = value
+				added = append(added, name)
+			}
+		}
+		a.Labels = ls
+
+		sort.Strings(added)
+		res = append(res, converter.Alert{Alert: a, Enriched: added})
+	}
+
+	return res
+}
+
+func (inv *Inventory) lookup(ls template.KV) (map[string]string, bool) {
+	for _, key := range inv.keys {
+		value, ok := ls[key]
+		if !ok {
+			continue
+		}
+		if record, ok := inv.index[key][value]; ok {
+			return record, true
+		}
+		// instance usually carries the exporter port
+		if host, _, err := net.SplitHostPort(value); err == nil {
+			if record, ok := inv.index[key][host]; ok {
+				return record, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// reload loads the file if it changed since last load.
+func (inv *Inventory) reload() (bool, error) {
+	fi, err := os.Stat(inv.file)
+	if err != nil {
+		return false, err
+	}
+
+	inv.mtx.RLock()
+	unchanged := fi.ModTime().Equal(inv.modTime)
+	inv.mtx.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	records, err := load(inv.file)
+	if err != nil {
+		return false, err
+	}
+
+	index := map[string]map[string]map[string]string{}
+	for _, key := range inv.keys {
+		index[key] = map[string]map[string]string{}
+	}
+	for _, record := range records {
+		for _, key := range inv.keys {
+			if value := record[key]; value != "" {
+				index[key][value] = record
+			}
+		}
+	}
+
+	inv.mtx.Lock()
+	inv.index, inv.modTime = index, fi.ModTime()
+	inv.mtx.Unlock()
+
+	entries.Set(float64(len(records)))
+	return true, nil
+}
+
+// load reads the records from a CSV file with header, or a YAML/JSON file
+// contains a list of label sets.
+func load(file string) ([]map[string]string, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []map[string]string
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".csv":
+		rows, err := csv.NewReader(strings.NewReader(string(content))).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rows {
+			if i == 0 {
+				continue
+			}
+			record := map[string]string{}
+			for j, name := range rows[0] {
+				if v := strings.TrimSpace(row[j]); v != "" {
+					record[strings.TrimSpace(name)] = v
+				}
+			}
+			records = append(records, record)
+		}
+	case ".json":
+		err = json.Unmarshal(content, &records)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(content, &records)
+	default:
+		err = fmt.Errorf("unsupported inventory format %q", ext)
+	}
+
+	return records, err
+}
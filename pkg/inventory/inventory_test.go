@@ -0,0 +1,78 @@
+package inventory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "inventory.csv")
+	content := "address,instance,datacenter,owner\n45.40.58.70,,mumbai,sre\n,45.40.58.71,lax,noc\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := New(file, []string{"address", "instance"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alerts := inv.Enrich(template.Alerts{
+		{Labels: template.KV{"alertname": "NodeDown", "address": "45.40.58.70", "owner": "ops"}},
+		{Labels: template.KV{"alertname": "NodeDown", "instance": "45.40.58.71:9100"}},
+		{Labels: template.KV{"alertname": "NodeDown", "address": "10.0.0.1"}},
+	})
+
+	want := []template.KV{
+		{"alertname": "NodeDown", "address": "45.40.58.70", "datacenter": "mumbai", "owner": "ops"},
+		{"alertname": "NodeDown", "instance": "45.40.58.71:9100", "datacenter": "lax", "owner": "noc"},
+		{"alertname": "NodeDown", "address": "10.0.0.1"},
+	}
+	for i, a := range alerts {
+		if !reflect.DeepEqual(want[i], a.Labels) {
+			t.Errorf("expected %v, but got %v", want[i], a.Labels)
+		}
+	}
+
+	// the inventory is reloaded when file changed
+	file2 := filepath.Join(dir, "inventory.yml")
+	if err := ioutil.WriteFile(file2, []byte("- address: 10.0.0.1\n  datacenter: tokyo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file2, future, future); err != nil {
+		t.Fatal(err)
+	}
+	inv.file = file2
+	if reloaded, err := inv.reload(); err != nil || !reloaded {
+		t.Fatalf("expected inventory reloaded, but got %v %v", reloaded, err)
+	}
+	if reloaded, _ := inv.reload(); reloaded {
+		t.Error("expected unchanged inventory not reloaded")
+	}
+
+	alerts = inv.Enrich(template.Alerts{{Labels: template.KV{"address": "10.0.0.1"}}})
+	if alerts[0].Labels["datacenter"] != "tokyo" {
+		t.Errorf("expected datacenter tokyo, but got %v", alerts[0].Labels)
+	}
+	// the AIOP ID does not change with the inventory
+	if id := converter.AlertID(alerts[0]); id != converter.FormatAIOPID(template.KV{"address": "10.0.0.1"}) {
+		t.Errorf("expected AIOP ID of original labels, but got %d", id)
+	}
+	if want := []string{"datacenter"}; !reflect.DeepEqual(want, alerts[0].Enriched) || len(alerts[0].Annotations) != 0 {
+		t.Errorf("expected enriched %v kept off the annotations, but got %v %v", want, alerts[0].Enriched, alerts[0].Annotations)
+	}
+}
@@ -0,0 +1,37 @@
+package log
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type requestIDKey struct{}
+
+// RequestIDHeader is the HTTP header carries the request ID.
+const RequestIDHeader = "X-Request-ID"
+
+// WithRequestID returns a context carries the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of context, empty if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// L returns the global logger with the request ID of context as field.
+func L(ctx context.Context) *zap.Logger {
+	if id := RequestID(ctx); id != "" {
+		return zap.L().With(zap.String("request_id", id))
+	}
+	return zap.L()
+}
+
+// S returns the global sugared logger with the request ID of context as
+// field.
+func S(ctx context.Context) *zap.SugaredLogger {
+	return L(ctx).Sugar()
+}
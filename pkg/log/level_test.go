@@ -0,0 +1,34 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSetLevel(t *testing.T) {
+	SetLevel(zapcore.InfoLevel, 0)
+
+	SetLevel(zapcore.DebugLevel, 20*time.Millisecond)
+	// a second temporary change keeps the original level to revert to
+	SetLevel(zapcore.WarnLevel, 20*time.Millisecond)
+
+	lvl, at := Level()
+	if lvl != zapcore.WarnLevel || at.IsZero() {
+		t.Fatalf("expected warn level with pending revert, but got %s %v", lvl, at)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	lvl, at = Level()
+	if lvl != zapcore.InfoLevel || !at.IsZero() {
+		t.Errorf("expected reverted to info level, but got %s %v", lvl, at)
+	}
+
+	SetLevel(zapcore.ErrorLevel, 20*time.Millisecond)
+	SetLevel(zapcore.DebugLevel, 0)
+	time.Sleep(50 * time.Millisecond)
+	if lvl, _ = Level(); lvl != zapcore.DebugLevel {
+		t.Errorf("expected permanent change cancels revert, but got %s", lvl)
+	}
+}
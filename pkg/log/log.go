@@ -1,6 +1,12 @@
 package log
 
 import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -8,11 +14,35 @@ import (
 var (
 	lg      *zap.Logger
 	encoder zapcore.Encoder
+	level   = zap.NewAtomicLevel()
 )
 
 // Options for the creation of a LOG object.
 type Options struct {
 	Level string
+	// Encoding is json or console, defaults to console
+	Encoding string
+	// OutputPaths are stdout, stderr or file paths, defaults to stderr
+	OutputPaths []string
+	// Rotation rotates the output files
+	Rotation Rotation
+	// SamplingInitial and SamplingThereafter limit the logs with same
+	// message per second, zero SamplingThereafter disables sampling
+	SamplingInitial    int
+	SamplingThereafter int
+	// Fields are added to every log entry, e.g. instance name
+	Fields map[string]string
+}
+
+// Rotation configures the rotation of output files.
+type Rotation struct {
+	// MaxSize is the maximum megabytes of file before rotated, zero disables
+	MaxSize int
+	// Interval is the maximum age of file before rotated, zero disables
+	Interval time.Duration
+	// MaxBackups is the maximum number of rotated files to retain, zero
+	// retains all of them
+	MaxBackups int
 }
 
 // Init initialize LOG object at once.
@@ -21,6 +51,7 @@ func Init(opts Options) (err error) {
 	if err := lvl.UnmarshalText([]byte(opts.Level)); err != nil {
 		return err
 	}
+	level.SetLevel(*lvl)
 
 	encodercfg := zapcore.EncoderConfig{
 		TimeKey:        "ts",
@@ -37,25 +68,113 @@ func Init(opts Options) (err error) {
 		EncodeName:     zapcore.FullNameEncoder,
 	}
 
-	cfg := zap.Config{
-		Level:       zap.NewAtomicLevelAt(*lvl),
-		Development: false,
-		Sampling: &zap.SamplingConfig{
-			Initial:    100,
-			Thereafter: 100,
-		},
-		Encoding:         "console",
-		EncoderConfig:    encodercfg,
-		OutputPaths:      []string{"stderr"},
-		ErrorOutputPaths: []string{"stderr"},
+	switch opts.Encoding {
+	case "json":
+		encodercfg.EncodeLevel = zapcore.LowercaseLevelEncoder
+		encoder = zapcore.NewJSONEncoder(encodercfg)
+	case "console", "":
+		encoder = zapcore.NewConsoleEncoder(encodercfg)
+	default:
+		return errUnknownEncoding(opts.Encoding)
 	}
 
-	if lg, err = cfg.Build(zap.AddCaller()); err != nil {
-		return err
+	if len(opts.OutputPaths) == 0 {
+		opts.OutputPaths = []string{"stderr"}
+	}
+
+	ws := make([]zapcore.WriteSyncer, 0, len(opts.OutputPaths))
+	for _, path := range opts.OutputPaths {
+		switch path {
+		case "stderr":
+			ws = append(ws, zapcore.Lock(os.Stderr))
+		case "stdout":
+			ws = append(ws, zapcore.Lock(os.Stdout))
+		default:
+			// a bad path fails at startup instead of the first write
+			w := newRotateWriter(path, opts.Rotation)
+			if err := w.open(); err != nil {
+				return fmt.Errorf("failed to open log file: %w", err)
+			}
+			ws = append(ws, w)
+		}
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.NewMultiWriteSyncer(ws...), level)
+	if opts.SamplingThereafter > 0 {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, opts.SamplingInitial, opts.SamplingThereafter)
 	}
 
+	names := make([]string, 0, len(opts.Fields))
+	for name := range opts.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]zap.Field, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, zap.String(name, opts.Fields[name]))
+	}
+
+	lg = zap.New(core, zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr)), zap.Fields(fields...))
+
 	// replaced global logger instance
 	zap.ReplaceGlobals(lg)
 
 	return
 }
+
+var (
+	revertMtx   sync.Mutex
+	revertTimer *time.Timer
+	revertAt    time.Time
+	revertLevel zapcore.Level
+)
+
+// Level returns the current log level and the time it is reverted at, the
+// time is zero without pending revert.
+func Level() (zapcore.Level, time.Time) {
+	revertMtx.Lock()
+	defer revertMtx.Unlock()
+
+	return level.Level(), revertAt
+}
+
+// SetLevel changes the log level at runtime, a positive ttl reverts it to
+// the previous level after ttl.
+func SetLevel(lvl zapcore.Level, ttl time.Duration) {
+	revertMtx.Lock()
+	defer revertMtx.Unlock()
+
+	prev := level.Level()
+	if revertTimer != nil {
+		// keep reverting to the level before the first temporary change
+		if revertTimer.Stop() {
+			prev = revertLevel
+		}
+		revertTimer, revertAt = nil, time.Time{}
+	}
+	level.SetLevel(lvl)
+
+	if ttl <= 0 {
+		return
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(ttl, func() {
+		revertMtx.Lock()
+		defer revertMtx.Unlock()
+
+		if revertTimer != t {
+			return
+		}
+		level.SetLevel(prev)
+		revertTimer, revertAt = nil, time.Time{}
+	})
+	revertTimer, revertAt, revertLevel = t, time.Now().Add(ttl), prev
+}
+
+type errUnknownEncoding string
+
+func (e errUnknownEncoding) Error() string {
+	return "unknown log encoding " + string(e)
+}
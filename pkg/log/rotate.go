@@ -0,0 +1,126 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the suffix of rotated files.
+const backupTimeFormat = "20060102T150405.000"
+
+// rotateWriter is a zapcore.WriteSyncer appends to a file and rotates it by
+// size and age.
+type rotateWriter struct {
+	filename string
+	rotation Rotation
+
+	mtx  sync.Mutex
+	file *os.File
+	size int64
+	// startedAt is when the current file started, the rotation interval is
+	// measured from it
+	startedAt time.Time
+}
+
+func newRotateWriter(filename string, rotation Rotation) *rotateWriter {
+	return &rotateWriter{filename: filename, rotation: rotation}
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	var (
+		maxSize = int64(w.rotation.MaxSize) * 1024 * 1024
+		now     = time.Now()
+	)
+	if (maxSize > 0 && w.size+int64(len(p)) > maxSize) ||
+		(w.rotation.Interval > 0 && now.Sub(w.startedAt) >= w.rotation.Interval) {
+		if err := w.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotateWriter) Sync() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+func (w *rotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.filename), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	// the file left by previous run is as old as its last write
+	startedAt := time.Now()
+	if fi.Size() > 0 {
+		startedAt = fi.ModTime()
+	}
+
+	w.file, w.size, w.startedAt = f, fi.Size(), startedAt
+	return nil
+}
+
+// rotate renames the current file with timestamp suffix, opens a new file
+// and removes the oldest backups.
+func (w *rotateWriter) rotate(now time.Time) error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	backup := fmt.Sprintf("%s.%s", w.filename, now.Format(backupTimeFormat))
+	if err := os.Rename(w.filename, backup); err != nil {
+		return err
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	if w.rotation.MaxBackups > 0 {
+		backups, err := filepath.Glob(w.filename + ".*")
+		if err != nil {
+			return err
+		}
+		// the timestamp suffix sorts in time order
+		sort.Strings(backups)
+		for len(backups) > w.rotation.MaxBackups {
+			os.Remove(backups[0])
+			backups = backups[1:]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateWriter(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "zenaiop.log")
+
+	w := newRotateWriter(filename, Rotation{MaxSize: 1, MaxBackups: 2})
+	line := []byte(strings.Repeat("x", 400*1024) + "\n")
+	for i := 0; i < 8; i++ {
+		if _, err := w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+		// backups are named by milliseconds
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("expected current file and 2 backups, but got %d files", len(files))
+	}
+	for _, fi := range files {
+		if fi.Size() > 1024*1024 {
+			t.Errorf("expected %s rotated before 1MB, but got %d bytes", fi.Name(), fi.Size())
+		}
+	}
+}
+
+func TestRotateWriterInterval(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "zenaiop.log")
+
+	w := newRotateWriter(filename, Rotation{Interval: 10 * time.Millisecond})
+	w.Write([]byte("first\n"))
+	time.Sleep(20 * time.Millisecond)
+	w.Write([]byte("second\n"))
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "second\n" {
+		t.Errorf("expected file rotated by interval, but got %q", content)
+	}
+}
+
+func TestRotateWriterExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "zenaiop.log")
+
+	if err := ioutil.WriteFile(filename, []byte("previous run\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filename, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// the age of file left by previous run counts towards interval
+	w := newRotateWriter(filename, Rotation{Interval: time.Minute})
+	w.Write([]byte("current run\n"))
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "current run\n" {
+		t.Errorf("expected old file rotated, but got %q", content)
+	}
+}
+
+func TestInitBadPath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the parent of path is a regular file
+	if err := Init(Options{Level: "info", OutputPaths: []string{filepath.Join(file, "zenaiop.log")}}); err == nil {
+		t.Error("expected error for unwritable log path")
+	}
+}
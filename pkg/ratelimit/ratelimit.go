@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	waitingAlerts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "ratelimit",
+		Name:      "waiting_alerts",
+		Help:      "Number of alerts waiting for the rate limiter of a target.",
+	}, []string{"target"})
+	throttledAlerts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "ratelimit",
+		Name:      "throttled_alerts_total",
+		Help:      "Total number of alerts delayed by the rate limiter of a target.",
+	}, []string{"target"})
+	waitSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "ratelimit",
+		Name:      "wait_seconds_total",
+		Help:      "Total time spent waiting for the rate limiter of a target.",
+	}, []string{"target"})
+)
+
+func init() {
+	prometheus.MustRegister(waitingAlerts, throttledAlerts, waitSeconds)
+}
+
+// Limiter is a token bucket rate limiter, tokens are refilled at the
+// sustained rate up to burst.
+type Limiter struct {
+	target string
+	rate   float64
+	burst  int
+
+	mtx    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// New creates a Limiter for the target which allows rate events per second
+// with bursts of at most burst events. A rate of zero disables limiting.
+func New(target string, rate float64, burst int) *Limiter {
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &Limiter{
+		target: target,
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Burst returns the maximum number of tokens can be taken at once.
+func (l *Limiter) Burst() int {
+	if l.rate <= 0 {
+		return math.MaxInt32
+	}
+	return l.burst
+}
+
+// Wait blocks until n tokens are available or the context is done, n should
+// not exceed Burst.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l.rate <= 0 || n <= 0 {
+		return nil
+	}
+	if n > l.burst {
+		n = l.burst
+	}
+
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+
+	throttledAlerts.WithLabelValues(l.target).Add(float64(n))
+	waitingAlerts.WithLabelValues(l.target).Add(float64(n))
+	defer waitingAlerts.WithLabelValues(l.target).Sub(float64(n))
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	start := time.Now()
+	select {
+	case <-t.C:
+		waitSeconds.WithLabelValues(l.target).Add(time.Since(start).Seconds())
+		return nil
+	case <-ctx.Done():
+		// give back the reserved tokens
+		l.mtx.Lock()
+		l.tokens += float64(n)
+		l.mtx.Unlock()
+		waitSeconds.WithLabelValues(l.target).Add(time.Since(start).Seconds())
+		return ctx.Err()
+	}
+}
+
+// reserve takes n tokens and returns how long the caller has to wait before
+// the tokens are actually available.
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
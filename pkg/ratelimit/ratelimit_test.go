@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterBurst(t *testing.T) {
+	l := New("test", 10, 5)
+
+	if d := l.reserve(5); d != 0 {
+		t.Errorf("expected no delay for burst, but got %s", d)
+	}
+
+	d := l.reserve(2)
+	if d < 150*time.Millisecond || d > 250*time.Millisecond {
+		t.Errorf("expected about 200ms delay, but got %s", d)
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := New("test", 0, 0)
+
+	for i := 0; i < 100; i++ {
+		if err := l.Wait(context.Background(), 1000); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestLimiterWaitCanceled(t *testing.T) {
+	l := New("test", 1, 1)
+	l.reserve(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, but got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,94 @@
+package relabel
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+	"gopkg.in/yaml.v2"
+)
+
+func TestProcess(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config string
+		input  template.KV
+		output template.KV
+	}{
+		{
+			name: "replace instance into address",
+			config: `
+- source_labels: [instance]
+  regex: '(.+):\d+'
+  target_label: address
+`,
+			input:  template.KV{"instance": "45.40.58.70:9100"},
+			output: template.KV{"instance": "45.40.58.70:9100", "address": "45.40.58.70"},
+		},
+		{
+			name: "drop loopback device",
+			config: `
+- source_labels: [alertname, device]
+  regex: '网卡.+;lo'
+  action: drop
+`,
+			input:  template.KV{"alertname": "网卡进剧增", "device": "lo"},
+			output: nil,
+		},
+		{
+			name: "keep prod environment",
+			config: `
+- source_labels: [environment]
+  regex: prod
+  action: keep
+`,
+			input:  template.KV{"environment": "prod"},
+			output: template.KV{"environment": "prod"},
+		},
+		{
+			name: "labelmap and labeldrop",
+			config: `
+- regex: '__meta_(.+)'
+  action: labelmap
+- regex: '__meta_.+'
+  action: labeldrop
+`,
+			input:  template.KV{"__meta_owner": "sre", "job": "node"},
+			output: template.KV{"owner": "sre", "job": "node"},
+		},
+		{
+			name: "hashmod",
+			config: `
+- source_labels: [address]
+  modulus: 8
+  target_label: shard
+  action: hashmod
+`,
+			input:  template.KV{"address": "45.40.58.70"},
+			output: template.KV{"address": "45.40.58.70", "shard": "4"},
+		},
+	} {
+		var cfgs []*Config
+		if err := yaml.UnmarshalStrict([]byte(tc.config), &cfgs); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if res := Process(tc.input, cfgs...); !reflect.DeepEqual(tc.output, res) {
+			t.Errorf("%s: expected %v, but got %v", tc.name, tc.output, res)
+		}
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	for _, config := range []string{
+		"- action: hashmod\n  target_label: shard\n",
+		"- action: replace\n",
+		"- action: labeldrop\n  regex: foo\n  target_label: bar\n",
+		"- action: unknown\n",
+	} {
+		var cfgs []*Config
+		if err := yaml.UnmarshalStrict([]byte(config), &cfgs); err == nil {
+			t.Errorf("expected error for config %q", config)
+		}
+	}
+}
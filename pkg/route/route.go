@@ -0,0 +1,85 @@
+package route
+
+import (
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// Route is a node of the routing tree, it selects the targets of alerts.
+type Route struct {
+	conf     *config.Route
+	targets  []string
+	children []*Route
+}
+
+// New creates the routing tree, the targets are inherited from parent if
+// the route does not specify any.
+func New(cr *config.Route, parent *Route) *Route {
+	r := &Route{conf: cr, targets: cr.Targets}
+	if len(r.targets) == 0 && parent != nil {
+		r.targets = parent.targets
+	}
+
+	for _, child := range cr.Routes {
+		r.children = append(r.children, New(child, r))
+	}
+
+	return r
+}
+
+// Match does a depth-first left-to-right search through the route tree
+// and returns the matching routing nodes.
+func (r *Route) Match(ls template.KV) []*Route {
+	if !r.matches(ls) {
+		return nil
+	}
+
+	var all []*Route
+	for _, child := range r.children {
+		matches := child.Match(ls)
+		all = append(all, matches...)
+
+		if matches != nil && !child.conf.Continue {
+			break
+		}
+	}
+
+	// if no child nodes were matches, the current node itself is a match.
+	if len(all) == 0 {
+		all = append(all, r)
+	}
+
+	return all
+}
+
+// Targets returns the distinct targets of the routes matching labels.
+func (r *Route) Targets(ls template.KV) []string {
+	var (
+		res  []string
+		seen = map[string]bool{}
+	)
+	for _, m := range r.Match(ls) {
+		for _, name := range m.targets {
+			if !seen[name] {
+				seen[name] = true
+				res = append(res, name)
+			}
+		}
+	}
+
+	return res
+}
+
+func (r *Route) matches(ls template.KV) bool {
+	for name, value := range r.conf.Match {
+		if ls[name] != value {
+			return false
+		}
+	}
+	for name, re := range r.conf.MatchRE {
+		if !re.MatchString(ls[name]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package route
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestRouteTargets(t *testing.T) {
+	cfg, err := config.Load(`
+targets:
+- name: SRE
+  url: http://aiop:5006/api/v1.0/recive_alert/inter_alarm/SRE
+- name: NOC
+  url: http://aiop:5006/api/v1.0/recive_alert/inter_alarm/NOC
+- name: CDN
+  url: http://aiop:5006/api/v1.0/recive_alert/inter_alarm/CDN
+
+route:
+  targets: [SRE]
+  routes:
+  - match:
+      platform: ZEN
+    targets: [NOC]
+    continue: true
+  - match_re:
+      cdnclass: 网页.+
+    targets: [CDN, NOC]
+  - match:
+      region: AP2
+    routes:
+    - match:
+        layer: C
+      targets: [CDN]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree := New(cfg.Route, nil)
+	for _, tc := range []struct {
+		labels  template.KV
+		targets []string
+	}{
+		{template.KV{"platform": "OTHER"}, []string{"SRE"}},
+		{template.KV{"platform": "ZEN"}, []string{"NOC"}},
+		{template.KV{"platform": "ZEN", "cdnclass": "网页加速"}, []string{"NOC", "CDN"}},
+		{template.KV{"region": "AP2"}, []string{"SRE"}},
+		{template.KV{"region": "AP2", "layer": "C"}, []string{"CDN"}},
+	} {
+		if targets := tree.Targets(tc.labels); !reflect.DeepEqual(tc.targets, targets) {
+			t.Errorf("%v: expected %v, but got %v", tc.labels, tc.targets, targets)
+		}
+	}
+}
@@ -1,58 +1,293 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/feifeigood/prometheus-zenaiop/pkg/alertmanager"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/cluster"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
 	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
-	"github.com/go-resty/resty/v2"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/health"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/history"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/inhibit"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/inventory"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/relabel"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/route"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/silence"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/sink"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/storm"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/tracing"
 	"github.com/prometheus/alertmanager/notify/webhook"
-	"go.uber.org/zap"
+	"github.com/prometheus/alertmanager/template"
 )
 
 // PostResponse is the prometheus msteams service response.
 type PostResponse struct {
+	Target     string `json:"target"`
 	WebhookURL string `json:"webhook_url"`
 	Status     int    `json:"status"`
 	Message    string `json:"message"`
+	// Retryable reports whether a failed delivery may succeed if resent
+	Retryable bool `json:"retryable,omitempty"`
+	// Rejected are the alerts the target refused while it accepted others
+	Rejected []sink.Rejection `json:"rejected,omitempty"`
 }
 
-// Service is Alertmanager to Zenlayer AIOP webhook service.
+// Service is Alertmanager to Zenlayer AIOP webhook service, the context
+// carries the request ID of webhook message.
 type Service interface {
-	Post(webhook.Message) (resp []PostResponse, err error)
+	Post(context.Context, webhook.Message) (resp []PostResponse, err error)
+}
+
+// Options for the creation of a simpleService object.
+type Options struct {
+	// Targets are the named destinations of alerts
+	Targets []*config.TargetConfig
+	// Route selects the targets of each alert
+	Route *config.Route
+	// RelabelConfigs rewrite the labels of alerts before any other stage
+	RelabelConfigs []*relabel.Config
+	// Storm configures the alerts storm aggregation of each target
+	Storm storm.Options
+	// History records the alerts not forwarded as is
+	History *history.History
+	// Alertmanager fetches the truncated alerts of group, nil disables it
+	Alertmanager *alertmanager.Client
+	// Silences suppress the alerts under maintenance
+	Silences *silence.Silences
+	// Inhibitor holds back the alerts inhibited by firing alerts
+	Inhibitor *inhibit.Inhibitor
+	// Inventory adds the missing labels to alerts, nil disables enrichment
+	Inventory *inventory.Inventory
+	// FlapHoldDown delays RESOLVED alerts, zero disables flap damping
+	FlapHoldDown time.Duration
+	// Deliveries records the outcome of deliveries to AIOP, nil disables it
+	Deliveries *health.Deliveries
+	// Cluster deduplicates the alerts sent by replicas, nil disables it
+	Cluster *cluster.Cluster
+	// Retry resends the deliveries failed with a retryable error
+	Retry Retry
+}
+
+// Retry configures the resending of the alerts a target failed to deliver
+// with a retryable error, the webhook message is kept in WAL meanwhile.
+type Retry struct {
+	// Backoff is the delay before the first retry, it is doubled after
+	// each attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of retries before the alerts are dropped,
+	// zero disables the retries
+	MaxAttempts int
+	// MaxAge is how long after the message was received the alerts are
+	// retried, zero is unlimited
+	MaxAge time.Duration
+}
+
+type messageKey struct{}
+
+// message identifies the webhook message a delivery belongs to.
+type message struct {
+	groupKey string
+	received time.Time
+}
+
+func messageFromContext(ctx context.Context) message {
+	m, _ := ctx.Value(messageKey{}).(message)
+	return m
 }
 
 type simpleService struct {
-	converter  converter.Converter
-	client     *resty.Client
-	webhookURL string
+	route   *route.Route
+	targets map[string]*target
+	opts    Options
 }
 
 // NewSimpleService creates a simpleService.
-func NewSimpleService(converter converter.Converter, webhookURL string) Service {
-	return simpleService{converter: converter, client: resty.New(), webhookURL: webhookURL}
+func NewSimpleService(opts Options) (Service, error) {
+	if opts.Retry.Backoff <= 0 {
+		opts.Retry.Backoff = 10 * time.Second
+	}
+	if opts.Retry.MaxBackoff <= 0 {
+		opts.Retry.MaxBackoff = 5 * time.Minute
+	}
+	s := simpleService{
+		route:   route.New(opts.Route, nil),
+		targets: map[string]*target{},
+		opts:    opts,
+	}
+	for _, conf := range opts.Targets {
+		t, err := newTarget(conf, opts)
+		if err != nil {
+			return nil, err
+		}
+		s.targets[conf.Name] = t
+	}
+
+	return s, nil
 }
 
-func (s simpleService) Post(wm webhook.Message) ([]PostResponse, error) {
-	alerts := converter.AIOPAlerts{}
-	err := s.converter.Convert(&alerts, wm)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse webhook message: %w", err)
+func (s simpleService) Post(ctx context.Context, wm webhook.Message) (_ []PostResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.post")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	span.SetAttribute("group_key", wm.GroupKey)
+	span.SetAttribute("alerts", len(wm.Alerts))
+	ctx = context.WithValue(ctx, messageKey{}, message{groupKey: wm.GroupKey, received: cluster.Received(ctx)})
+
+	alerts, truncated := s.fetchTruncated(ctx, wm)
+	alerts = s.relabel(ctx, alerts)
+	as := converter.NewAlerts(alerts)
+	if s.opts.Inventory != nil {
+		as = s.opts.Inventory.Enrich(alerts)
 	}
+	s.opts.Inhibitor.Update(as.Template())
+	as = s.mute(ctx, as)
 
-	// post time range in > 21:00 PM or < 10:00 AM
-	t := time.Now()
-	if t.Hour() >= 21 || t.Hour() <= 9 {
-		resp, err := s.client.R().EnableTrace().SetHeader("Content-Type", "application/json").SetBody(jsonMarshal(map[string]interface{}{"alerts": alerts})).Post(s.webhookURL)
+	var (
+		names  []string
+		routed = map[string]converter.Alerts{}
+	)
+	for _, a := range as {
+		for _, name := range s.route.Targets(a.Labels) {
+			if _, ok := routed[name]; !ok {
+				names = append(names, name)
+			}
+			routed[name] = append(routed[name], a)
+		}
+	}
+
+	// the truncated alerts are reported to the targets of group
+	if len(names) == 0 && truncated > 0 {
+		ls := template.KV{}
+		for name, value := range wm.CommonLabels {
+			ls[name] = value
+		}
+		for name, value := range wm.GroupLabels {
+			ls[name] = value
+		}
+		names = s.route.Targets(ls)
+	}
+	// and resolved on the targets they were reported to, wherever the
+	// alerts of group are routed now
+	for _, conf := range s.opts.Targets {
+		if !contains(names, conf.Name) && s.targets[conf.Name].hasTruncated(wm.GroupKey) {
+			names = append(names, conf.Name)
+		}
+	}
+
+	var (
+		resps []PostResponse
+		errs  []string
+	)
+	for _, name := range names {
+		resp, err := s.targets[name].post(ctx, wm, routed[name], truncated)
+		resps = append(resps, resp)
 		if err != nil {
-			return nil, err
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return resps, fmt.Errorf("failed to post to targets: %s", strings.Join(errs, "; "))
+	}
+
+	return resps, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// relabel applies the relabel configs to alerts and drops the alerts whose
+// labels are dropped.
+func (s simpleService) relabel(ctx context.Context, alerts template.Alerts) template.Alerts {
+	if len(s.opts.RelabelConfigs) == 0 {
+		return alerts
+	}
+
+	res := make(template.Alerts, 0, len(alerts))
+	for _, a := range alerts {
+		ls := relabel.Process(a.Labels, s.opts.RelabelConfigs...)
+		if ls == nil {
+			log.S(ctx).Debugf("alerting dropped by relabeling => %s", jsonMarshal(a))
+			s.opts.History.Add("dropped", "relabel", a)
+			continue
+		}
+		a.Labels = ls
+		res = append(res, a)
+	}
+
+	return res
+}
+
+// mute drops the alerts matched by an active silence or inhibited by a
+// firing alert.
+func (s simpleService) mute(ctx context.Context, alerts converter.Alerts) converter.Alerts {
+	res := make(converter.Alerts, 0, len(alerts))
+	for _, a := range alerts {
+		if id, ok := s.opts.Silences.Mutes(a.Labels); ok {
+			log.S(ctx).Infof("alerting silenced by %s => %s", id, jsonMarshal(a))
+			s.opts.History.Add("silenced", id, a.Alert)
+			continue
 		}
+		if fp, ok := s.opts.Inhibitor.Mutes(a.Alert); ok {
+			log.S(ctx).Infof("alerting inhibited by %s => %s", fp, jsonMarshal(a))
+			s.opts.History.Add("inhibited", fp, a.Alert)
+			continue
+		}
+		res = append(res, a)
+	}
+
+	return res
+}
+
+// fetchTruncated completes the alerts of message truncated by Alertmanager,
+// it returns the alerts and the number of alerts still missing.
+func (s simpleService) fetchTruncated(ctx context.Context, wm webhook.Message) (template.Alerts, uint64) {
+	if wm.TruncatedAlerts == 0 || s.opts.Alertmanager == nil || wm.Status != "firing" {
+		return wm.Alerts, wm.TruncatedAlerts
+	}
 
-		zap.S().Infof("send notification to aiop webhook status: %d, body: %s", resp.StatusCode(), resp.Body())
+	fetched, err := s.opts.Alertmanager.GroupAlerts(ctx, wm.ExternalURL, wm.Receiver, wm.GroupLabels)
+	if err != nil {
+		log.S(ctx).Errorf("failed to fetch truncated alerts of group %s: %v", wm.GroupKey, err)
+		return wm.Alerts, wm.TruncatedAlerts
+	}
+
+	seen := map[string]bool{}
+	for _, a := range wm.Alerts {
+		seen[a.Fingerprint] = true
+	}
+
+	var (
+		alerts    = append(template.Alerts{}, wm.Alerts...)
+		truncated = wm.TruncatedAlerts
+	)
+	for _, a := range fetched {
+		if seen[a.Fingerprint] {
+			continue
+		}
+		seen[a.Fingerprint] = true
+		alerts = append(alerts, a)
+		if truncated > 0 {
+			truncated--
+		}
 	}
 
-	return nil, nil
+	return alerts, truncated
 }
 
 func jsonMarshal(v interface{}) string {
@@ -0,0 +1,577 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/ack"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/cluster"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/health"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/history"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/inhibit"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/silence"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
+
+type aiopServer struct {
+	*httptest.Server
+
+	mtx        sync.Mutex
+	received   map[string][]string
+	alerts     map[string]converter.AIOPAlerts
+	requestIDs []string
+	// requests counts the requests by path
+	requests map[string]int
+	// unavailable is the number of requests answered 503 by path, negative
+	// answers all of them
+	unavailable map[string]int
+}
+
+func newAIOPServer() *aiopServer {
+	s := &aiopServer{
+		received:    map[string][]string{},
+		alerts:      map[string]converter.AIOPAlerts{},
+		requests:    map[string]int{},
+		unavailable: map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Alerts converter.AIOPAlerts `json:"alerts"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		s.requests[r.URL.Path]++
+		if n := s.unavailable[r.URL.Path]; n != 0 {
+			s.unavailable[r.URL.Path] = n - 1
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		s.requestIDs = append(s.requestIDs, r.Header.Get(log.RequestIDHeader))
+		for _, a := range body.Alerts {
+			s.received[r.URL.Path] = append(s.received[r.URL.Path], a.Infor)
+		}
+		s.alerts[r.URL.Path] = append(s.alerts[r.URL.Path], body.Alerts...)
+		w.Write([]byte(`{"code":0}`))
+	}))
+	return s
+}
+
+// newTestService creates a service with the targets and route of yml, the
+// target URLs are rebased on url and opts adjust the options.
+func newTestService(t *testing.T, yml string, url string, opts ...func(*Options)) Service {
+	cfg, err := config.Load(yml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range cfg.Targets {
+		tc.URL = url + strings.TrimPrefix(tc.URL, "http://aiop")
+	}
+
+	sil, err := silence.New(t.TempDir() + "/silences.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := Options{
+		Targets:   cfg.Targets,
+		Route:     cfg.Route,
+		History:   history.New(10),
+		Silences:  sil,
+		Inhibitor: inhibit.New(nil, time.Hour),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	svc, err := NewSimpleService(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return svc
+}
+
+func TestPostRouting(t *testing.T) {
+	srv := newAIOPServer()
+	defer srv.Close()
+
+	svc := newTestService(t, `
+targets:
+- name: SRE
+  url: http://aiop/SRE
+- name: CDN
+  url: http://aiop/CDN
+route:
+  targets: [SRE]
+  routes:
+  - match:
+      platform: ZEN
+    targets: [CDN]
+`, srv.URL)
+
+	resps, err := svc.Post(log.WithRequestID(context.Background(), "req-1"), webhook.Message{Data: &template.Data{
+		Status: "firing",
+		Alerts: template.Alerts{
+			{Status: "firing", Labels: template.KV{"alertname": "NodeDown", "address": "10.0.0.1", "platform": "ZEN"}},
+			{Status: "firing", Labels: template.KV{"alertname": "NodeDown", "address": "10.0.0.2", "platform": "OTHER"}},
+			{Status: "firing", Labels: template.KV{"alertname": "DomainDown", "domain": "example.com"}},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resps) != 2 {
+		t.Errorf("expected 2 responses, but got %v", resps)
+	}
+
+	sort.Strings(srv.received["/SRE"])
+	want := map[string][]string{
+		"/CDN": {"ECN-CDN-NODE(10.0.0.1)"},
+		"/SRE": {"ECN-CDN-BIZ(example.com)", "ECN-CDN-NODE(10.0.0.2)"},
+	}
+	if !reflect.DeepEqual(want, srv.received) {
+		t.Errorf("expected %v, but got %v", want, srv.received)
+	}
+	if !reflect.DeepEqual([]string{"req-1", "req-1"}, srv.requestIDs) {
+		t.Errorf("expected request ID sent to targets, but got %v", srv.requestIDs)
+	}
+}
+
+func TestPostRetryAndRejection(t *testing.T) {
+	retryBackoff = time.Millisecond
+	defer func() { retryBackoff = time.Second }()
+
+	var (
+		mtx      sync.Mutex
+		attempts int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"code":0,"rejected":[{"id":1,"reason":"unknown device"}]}`))
+	}))
+	defer srv.Close()
+
+	svc := newTestService(t, `
+targets:
+- name: SRE
+  url: http://aiop/SRE
+route:
+  targets: [SRE]
+`, srv.URL)
+
+	resps, err := svc.Post(context.Background(), webhook.Message{Data: &template.Data{
+		Status: "firing",
+		Alerts: template.Alerts{
+			{Status: "firing", Labels: template.KV{"alertname": "NodeDown", "address": "10.0.0.1"}},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if attempts != 2 {
+		t.Errorf("expected retry after 503, but got %d attempts", attempts)
+	}
+	if len(resps) != 1 || len(resps[0].Rejected) != 1 || resps[0].Rejected[0].Reason != "unknown device" {
+		t.Errorf("expected rejection in response, but got %+v", resps)
+	}
+}
+
+func TestPostPermanentFailure(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		attempts int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":400,"message":"invalid alerts"}`))
+	}))
+	defer srv.Close()
+
+	svc := newTestService(t, `
+targets:
+- name: SRE
+  url: http://aiop/SRE
+route:
+  targets: [SRE]
+`, srv.URL)
+
+	resps, err := svc.Post(context.Background(), webhook.Message{Data: &template.Data{
+		Status: "firing",
+		Alerts: template.Alerts{
+			{Status: "firing", Labels: template.KV{"alertname": "NodeDown", "address": "10.0.0.1"}},
+		},
+	}})
+	if err == nil {
+		t.Fatal("expected permanent failure")
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if attempts != 1 || resps[0].Retryable || resps[0].Status != http.StatusBadRequest {
+		t.Errorf("expected no retry of permanent failure, but got %d attempts %+v", attempts, resps)
+	}
+}
+
+func TestPostFlappingMessageTruncated(t *testing.T) {
+	srv := newAIOPServer()
+	defer srv.Close()
+
+	svc := newTestService(t, `
+targets:
+- name: SRE
+  url: http://aiop/SRE
+  message:
+    max_length: 30
+route:
+  targets: [SRE]
+`, srv.URL, func(o *Options) { o.FlapHoldDown = time.Hour })
+
+	post := func(status string) {
+		_, err := svc.Post(context.Background(), webhook.Message{Data: &template.Data{
+			Status: status,
+			Alerts: template.Alerts{{
+				Status:      status,
+				Labels:      template.KV{"alertname": "NodeDown", "address": "10.0.0.1"},
+				Annotations: template.KV{"description": "node 10.0.0.1 is down"},
+			}},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the RESOLVED is cancelled by firing again
+	post("firing")
+	post("resolved")
+	post("firing")
+
+	srv.mtx.Lock()
+	defer srv.mtx.Unlock()
+	if alerts := srv.alerts["/SRE"]; len(alerts) != 2 {
+		t.Fatalf("expected 2 PROBLEM sent, but got %v", alerts)
+	}
+	for _, a := range srv.alerts["/SRE"] {
+		if len(a.Message) > 30 {
+			t.Errorf("expected message cut to max_length, but got %q", a.Message)
+		}
+	}
+}
+
+func TestPostTruncatedResolved(t *testing.T) {
+	srv := newAIOPServer()
+	defer srv.Close()
+
+	svc := newTestService(t, `
+targets:
+- name: SRE
+  url: http://aiop/SRE
+route:
+  targets: [SRE]
+`, srv.URL)
+
+	post := func(status string, truncated uint64) {
+		_, err := svc.Post(context.Background(), webhook.Message{
+			Data: &template.Data{
+				Status:      status,
+				GroupLabels: template.KV{"alertname": "NodeDown"},
+				Alerts: template.Alerts{
+					{Status: status, Labels: template.KV{"alertname": "NodeDown", "address": "10.0.0.1"}},
+				},
+			},
+			GroupKey:        "{}:{alertname=\"NodeDown\"}",
+			TruncatedAlerts: truncated,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	post("firing", 2)
+	post("resolved", 0)
+
+	srv.mtx.Lock()
+	defer srv.mtx.Unlock()
+	var statuses []string
+	for _, a := range srv.alerts["/SRE"] {
+		if a.Type == "ECN-CDN-TRUNCATED" {
+			statuses = append(statuses, a.Status)
+		}
+	}
+	if want := []string{"PROBLEM", "RESOLVED"}; !reflect.DeepEqual(want, statuses) {
+		t.Errorf("expected truncated alert resolved with group, but got %v", statuses)
+	}
+}
+
+func TestPostTruncatedResolvedOnReportedTargets(t *testing.T) {
+	srv := newAIOPServer()
+	defer srv.Close()
+
+	var sil *silence.Silences
+	svc := newTestService(t, `
+targets:
+- name: SRE
+  url: http://aiop/SRE
+- name: CDN
+  url: http://aiop/CDN
+route:
+  targets: [SRE]
+  routes:
+  - match:
+      team: cdn
+    targets: [CDN]
+`, srv.URL, func(o *Options) { sil = o.Silences })
+
+	post := func(status string, truncated uint64) {
+		_, err := svc.Post(context.Background(), webhook.Message{
+			Data: &template.Data{
+				Status:       status,
+				GroupLabels:  template.KV{"alertname": "NodeDown"},
+				CommonLabels: template.KV{"alertname": "NodeDown"},
+				Alerts: template.Alerts{
+					{Status: status, Labels: template.KV{"alertname": "NodeDown", "address": "10.0.0.1", "team": "cdn"}},
+				},
+			},
+			GroupKey:        "{}:{alertname=\"NodeDown\"}",
+			TruncatedAlerts: truncated,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	post("firing", 2)
+	// the RESOLVED routed by the group labels would go to SRE
+	if _, err := sil.Create(silence.Silence{
+		Matchers:  []string{`address="10.0.0.1"`},
+		StartsAt:  time.Now().Add(-time.Minute),
+		EndsAt:    time.Now().Add(time.Hour),
+		CreatedBy: "test",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	post("resolved", 0)
+
+	srv.mtx.Lock()
+	defer srv.mtx.Unlock()
+	var statuses []string
+	for _, a := range srv.alerts["/CDN"] {
+		if a.Type == "ECN-CDN-TRUNCATED" {
+			statuses = append(statuses, a.Status)
+		}
+	}
+	if want := []string{"PROBLEM", "RESOLVED"}; !reflect.DeepEqual(want, statuses) {
+		t.Errorf("expected truncated alert resolved on CDN, but got %v", statuses)
+	}
+	if n := len(srv.alerts["/SRE"]); n != 0 {
+		t.Errorf("expected nothing sent to SRE, but got %d alerts", n)
+	}
+}
+
+func TestPostDeliveriesAIOPOnly(t *testing.T) {
+	retryBackoff = time.Millisecond
+	defer func() { retryBackoff = time.Second }()
+
+	srv := newAIOPServer()
+	defer srv.Close()
+	srv.unavailable["/hook"] = -1
+
+	deliveries := health.NewDeliveries(time.Minute)
+	svc := newTestService(t, `
+targets:
+- name: SRE
+  url: http://aiop/SRE
+- name: hook
+  type: webhook
+  url: http://aiop/hook
+route:
+  targets: [SRE, hook]
+`, srv.URL, func(o *Options) { o.Deliveries = deliveries })
+
+	if _, err := svc.Post(context.Background(), webhook.Message{Data: &template.Data{
+		Status: "firing",
+		Alerts: template.Alerts{
+			{Status: "firing", Labels: template.KV{"alertname": "NodeDown", "address": "10.0.0.1"}},
+		},
+	}}); err == nil {
+		t.Fatal("expected webhook target failure")
+	}
+
+	if rate, total := deliveries.SuccessRate(); rate != 1 || total != 1 {
+		t.Errorf("expected only the AIOP delivery observed, but got %.2f of %d", rate, total)
+	}
+}
+
+// postAcked posts the message and waits until it is acknowledged, i.e. all
+// its deferred deliveries completed.
+func postAcked(t *testing.T, svc Service, wm webhook.Message) {
+	acked := make(chan struct{})
+	tr := ack.New(func() { close(acked) })
+	// stamped as the dispatcher does
+	ctx := cluster.WithReceived(context.Background(), time.Now())
+	svc.Post(ack.NewContext(ctx, tr), wm)
+	tr.Release()
+
+	select {
+	case <-acked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected message acknowledged before deadline")
+	}
+}
+
+func TestPostRetryFailedTarget(t *testing.T) {
+	retryBackoff = time.Millisecond
+	defer func() { retryBackoff = time.Second }()
+
+	srv := newAIOPServer()
+	defer srv.Close()
+	srv.unavailable["/hook"] = -1
+
+	svc := newTestService(t, `
+targets:
+- name: SRE
+  url: http://aiop/SRE
+- name: hook
+  type: webhook
+  url: http://aiop/hook
+route:
+  targets: [SRE, hook]
+`, srv.URL, func(o *Options) {
+		o.Retry = Retry{Backoff: time.Millisecond, MaxBackoff: time.Millisecond, MaxAttempts: 2}
+	})
+
+	postAcked(t, svc, webhook.Message{Data: &template.Data{
+		Status: "firing",
+		Alerts: template.Alerts{
+			{Status: "firing", Labels: template.KV{"alertname": "NodeDown", "address": "10.0.0.1"}},
+		},
+	}})
+
+	// each delivery is sent 1+maxRetries times, the failed target alone is
+	// retried MaxAttempts times and then dropped
+	srv.mtx.Lock()
+	defer srv.mtx.Unlock()
+	if n := srv.requests["/SRE"]; n != 1 {
+		t.Errorf("expected delivered target sent once, but got %d requests", n)
+	}
+	if n, want := srv.requests["/hook"], 3*(1+maxRetries); n != want {
+		t.Errorf("expected %d requests to failed target, but got %d", want, n)
+	}
+}
+
+func TestPostRetrySuperseded(t *testing.T) {
+	retryBackoff = time.Millisecond
+	defer func() { retryBackoff = time.Second }()
+
+	srv := newAIOPServer()
+	defer srv.Close()
+	// the PROBLEM fails once with its quick retries
+	srv.unavailable["/SRE"] = 1 + maxRetries
+
+	svc := newTestService(t, `
+targets:
+- name: SRE
+  url: http://aiop/SRE
+route:
+  targets: [SRE]
+`, srv.URL, func(o *Options) {
+		o.Retry = Retry{Backoff: 50 * time.Millisecond, MaxBackoff: time.Second, MaxAttempts: 3}
+	})
+
+	message := func(status string) webhook.Message {
+		return webhook.Message{
+			Data: &template.Data{
+				Status: status,
+				Alerts: template.Alerts{
+					{Status: status, Labels: template.KV{"alertname": "NodeDown", "address": "10.0.0.1"}},
+				},
+			},
+			GroupKey: "{}:{alertname=\"NodeDown\"}",
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		postAcked(t, svc, message("firing"))
+		close(done)
+	}()
+	// the RESOLVED is delivered while the PROBLEM waits for retry
+	time.Sleep(20 * time.Millisecond)
+	postAcked(t, svc, message("resolved"))
+	<-done
+
+	srv.mtx.Lock()
+	defer srv.mtx.Unlock()
+	var statuses []string
+	for _, a := range srv.alerts["/SRE"] {
+		statuses = append(statuses, a.Status)
+	}
+	if want := []string{"RESOLVED"}; !reflect.DeepEqual(want, statuses) {
+		t.Errorf("expected retry of older PROBLEM dropped, but got %v", statuses)
+	}
+}
+
+func TestPostHeldDownWaitsForPeers(t *testing.T) {
+	srv := newAIOPServer()
+	defer srv.Close()
+
+	const (
+		holdDown    = 150 * time.Millisecond
+		peerTimeout = 100 * time.Millisecond
+	)
+	// the peer ordered before this replica is alive until an exchange fails
+	peers := cluster.New(cluster.Options{Self: "http://zenaiop-b", Peers: []string{"http://zenaiop-a"}, PeerTimeout: peerTimeout})
+
+	svc := newTestService(t, `
+targets:
+- name: SRE
+  url: http://aiop/SRE
+route:
+  targets: [SRE]
+`, srv.URL, func(o *Options) {
+		o.FlapHoldDown = holdDown
+		o.Cluster = peers
+	})
+
+	start := time.Now()
+	postAcked(t, svc, webhook.Message{Data: &template.Data{
+		Status: "resolved",
+		Alerts: template.Alerts{
+			{Status: "resolved", Labels: template.KV{"alertname": "NodeDown", "address": "10.0.0.1"}},
+		},
+	}})
+
+	// the turn is measured from the end of hold-down, not from receipt
+	if elapsed := time.Since(start); elapsed < holdDown+peerTimeout {
+		t.Errorf("expected RESOLVED sent after hold-down and peer timeout, but got %s", elapsed)
+	}
+	srv.mtx.Lock()
+	defer srv.mtx.Unlock()
+	if len(srv.alerts["/SRE"]) != 1 {
+		t.Errorf("expected RESOLVED sent once, but got %v", srv.alerts["/SRE"])
+	}
+}
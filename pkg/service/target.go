@@ -0,0 +1,453 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/ack"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/cluster"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/flap"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/health"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/history"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/ratelimit"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/sink"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/storm"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/tracing"
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	rejectedAlerts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "target",
+		Name:      "rejected_alerts_total",
+		Help:      "Total number of alerts a target refused while it accepted the others.",
+	}, []string{"target"})
+	droppedRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "target",
+		Name:      "dropped_retries_total",
+		Help:      "Total number of failed alerts given up instead of retried, by reason.",
+	}, []string{"target", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(rejectedAlerts, droppedRetries)
+}
+
+// maxRetries is the number of times a retryable delivery is resent, waiting
+// retryBackoff doubled after each attempt.
+var (
+	maxRetries   = 3
+	retryBackoff = time.Second
+)
+
+// target converts and delivers the alerts routed to a named destination.
+type target struct {
+	conf       *config.TargetConfig
+	converter  converter.Converter
+	timeFormat converter.TimeFormat
+	msgFormat  converter.MessageFormat
+	sink       sink.Sink
+	limiter    *ratelimit.Limiter
+	aggregator *storm.Aggregator
+	damper     *flap.Damper
+	history    *history.History
+	deliveries *health.Deliveries
+	cluster    *cluster.Cluster
+	retry      Retry
+
+	mtx sync.Mutex
+	// truncated holds the group keys with a truncated alert sent
+	truncated map[string]bool
+	// retries holds the failed deliveries waiting for retry by group key
+	retries map[string][]*retrying
+}
+
+// retrying is the alerts of a webhook message failed to be delivered.
+type retrying struct {
+	msg      message
+	alerts   converter.AIOPAlerts
+	attempts int
+	// superseded is set when a newer message of group was delivered
+	superseded bool
+	release    func()
+}
+
+func newTarget(conf *config.TargetConfig, opts Options) (*target, error) {
+	sk, err := sink.New(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	tf, err := converter.NewTimeFormat(conf.Time.TimeZone, conf.Time.Layout, conf.Time.ResolvedTime == config.ResolvedEndsAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time of target %q: %w", conf.Name, err)
+	}
+	mf := converter.MessageFormat{
+		Annotations:  conf.Message.Annotations,
+		Summary:      conf.Message.Summary,
+		Labels:       conf.Message.Labels,
+		GeneratorURL: conf.Message.GeneratorURL,
+		SilenceURL:   conf.Message.SilenceURL,
+		MaxLength:    conf.Message.MaxLength,
+	}
+	so := opts.Storm
+	so.TimeFormat = tf
+
+	var (
+		rate  float64
+		burst int
+	)
+	if conf.RateLimit != nil {
+		rate, burst = conf.RateLimit.Rate, conf.RateLimit.Burst
+	}
+
+	t := &target{
+		conf:       conf,
+		converter:  converter.New(converter.Options{TimeFormat: tf, MessageFormat: mf}),
+		timeFormat: tf,
+		msgFormat:  mf,
+		sink:       sk,
+		limiter:    ratelimit.New(conf.Name, rate, burst),
+		aggregator: storm.New(so),
+		history:    opts.History,
+		deliveries: opts.Deliveries,
+		cluster:    opts.Cluster,
+		retry:      opts.Retry,
+		truncated:  map[string]bool{},
+		retries:    map[string][]*retrying{},
+	}
+	t.damper = flap.New(opts.FlapHoldDown, t.sendHeldDown)
+
+	return t, nil
+}
+
+// post converts the alerts of message and sends them, truncated is the
+// number of alerts missing from the message.
+func (t *target) post(ctx context.Context, wm webhook.Message, as converter.Alerts, truncated uint64) (PostResponse, error) {
+	as, summaries := t.aggregator.Aggregate(as)
+
+	alerts := converter.AIOPAlerts{}
+	if len(as) != 0 {
+		cm := converter.Message{Message: wm, Alerts: as}
+		if err := t.converter.Convert(ctx, &alerts, cm); err != nil {
+			return t.response(0, err.Error()), fmt.Errorf("failed to parse webhook message: %w", err)
+		}
+	}
+
+	for _, summary := range summaries {
+		if summary.Partial {
+			log.S(ctx).Infof("collapsed %d resolved alerts into storm %d still firing(%s)", len(summary.Alerts), summary.Alert.ID, t.conf.Name)
+			t.history.Add("aggregated", fmt.Sprint(summary.Alert.ID), summary.Alerts.Template()...)
+			continue
+		}
+		log.S(ctx).Infof("collapsed %d alerts into summary alerting(%s) => %s", len(summary.Alerts), t.conf.Name, jsonMarshal(summary.Alert))
+		t.history.Add("aggregated", fmt.Sprint(summary.Alert.ID), summary.Alerts.Template()...)
+		alerts = append(alerts, summary.Alert)
+	}
+
+	if aa, ok := t.truncatedAlert(wm, truncated); ok {
+		if truncated > 0 {
+			log.S(ctx).Warnf("%d alerts of group %s truncated by Alertmanager => %s", truncated, wm.GroupKey, jsonMarshal(aa))
+		} else {
+			log.S(ctx).Infof("truncated alerts of group %s resolved => %s", wm.GroupKey, jsonMarshal(aa))
+		}
+		alerts = append(alerts, aa)
+	}
+
+	return t.send(ctx, t.damper.Filter(ctx, alerts))
+}
+
+// truncatedAlert returns the alert reports the truncated alerts of group, it
+// is resolved once the group resolved or is no longer truncated.
+func (t *target) truncatedAlert(wm webhook.Message, truncated uint64) (converter.AIOPAlert, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if truncated == 0 && !t.truncated[wm.GroupKey] {
+		return converter.AIOPAlert{}, false
+	}
+
+	aa := converter.FormatTruncatedAlert(wm, truncated, t.timeFormat)
+	if truncated == 0 {
+		aa.Status = converter.FormatAIOPStatus("resolved")
+	}
+	if aa.Status == converter.FormatAIOPStatus("resolved") {
+		delete(t.truncated, wm.GroupKey)
+	} else {
+		t.truncated[wm.GroupKey] = true
+	}
+	return aa, true
+}
+
+// hasTruncated reports whether a truncated alert of group was sent and is
+// not resolved yet.
+func (t *target) hasTruncated(groupKey string) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return t.truncated[groupKey]
+}
+
+// send delivers the alerts to sink when the schedule is active.
+func (t *target) send(ctx context.Context, alerts converter.AIOPAlerts) (PostResponse, error) {
+	if len(alerts) == 0 {
+		return t.response(0, "no alerts"), nil
+	}
+
+	// the flap damper appends to messages, so they are cut last
+	for i := range alerts {
+		alerts[i].Message = t.msgFormat.Truncate(alerts[i].Message)
+	}
+
+	_, span := tracing.Start(ctx, "schedule")
+	active := t.conf.Schedule.Active(time.Now())
+	span.SetAttribute("target", t.conf.Name)
+	span.SetAttribute("active", active)
+	span.End()
+
+	if !active {
+		log.S(ctx).Debugf("skip sending %d alerts to %s outside schedule", len(alerts), t.conf.Name)
+		return t.response(0, "outside schedule"), nil
+	}
+
+	if alerts = t.cluster.Filter(ctx, t.conf.Name, alerts, t.sendWaited); len(alerts) == 0 {
+		return t.response(0, "sent by peer or waiting for peers"), nil
+	}
+
+	return t.deliver(ctx, alerts)
+}
+
+// deliver sends the alerts to sink, the alerts not delivered for a
+// retryable error are retried later.
+func (t *target) deliver(ctx context.Context, alerts converter.AIOPAlerts) (PostResponse, error) {
+	resp, failed, err := t.sendAll(ctx, alerts)
+	if err != nil && resp.Retryable {
+		t.retryLater(ctx, &retrying{msg: messageFromContext(ctx), alerts: failed})
+	}
+	return resp, err
+}
+
+// sendAll sends the alerts to sink in batches the limiter grants, it returns
+// the alerts not delivered on failure.
+func (t *target) sendAll(ctx context.Context, alerts converter.AIOPAlerts) (PostResponse, converter.AIOPAlerts, error) {
+	// split alerts into batches the limiter can grant at once, the
+	// remaining alerts wait for tokens instead of being dropped
+	var (
+		resp     = t.response(0, "")
+		size     = t.limiter.Burst()
+		rejected []sink.Rejection
+	)
+	for len(alerts) > 0 {
+		n := size
+		if n > len(alerts) {
+			n = len(alerts)
+		}
+
+		if err := t.limiter.Wait(ctx, n); err != nil {
+			return t.response(0, err.Error()), alerts, err
+		}
+
+		res, err := t.sendBatch(ctx, alerts[:n])
+		rejected = append(rejected, res.Rejected...)
+		resp = t.response(res.Status, res.Message)
+		resp.Rejected = rejected
+		if err != nil {
+			resp.Retryable = sink.IsRetryable(err)
+			return resp, alerts, err
+		}
+		t.cluster.Record(ctx, t.conf.Name, accepted(alerts[:n], res.Rejected))
+		alerts = alerts[n:]
+	}
+	t.supersede(messageFromContext(ctx))
+
+	return resp, nil, nil
+}
+
+// retryLater schedules the retry of failed alerts after backoff, they are
+// dropped once the attempts or age are exhausted.
+func (t *target) retryLater(ctx context.Context, r *retrying) {
+	if t.retry.MaxAttempts <= 0 {
+		return
+	}
+
+	var reason string
+	switch {
+	case r.attempts >= t.retry.MaxAttempts:
+		reason = "attempts"
+	case t.retry.MaxAge > 0 && time.Since(r.msg.received) >= t.retry.MaxAge:
+		reason = "age"
+	}
+	if reason != "" {
+		t.dropRetry(ctx, r, reason)
+		return
+	}
+
+	if r.release == nil {
+		// the message stays in WAL until the retries end
+		r.release = ack.Hold(ctx)
+	}
+	backoff := t.retry.Backoff << uint(r.attempts)
+	if backoff > t.retry.MaxBackoff || backoff <= 0 {
+		backoff = t.retry.MaxBackoff
+	}
+	r.attempts++
+
+	t.mtx.Lock()
+	t.retries[r.msg.groupKey] = append(t.retries[r.msg.groupKey], r)
+	t.mtx.Unlock()
+
+	log.S(ctx).Warnf("retrying %d alerts to %s in %s, attempt %d of %d", len(r.alerts), t.conf.Name, backoff, r.attempts, t.retry.MaxAttempts)
+	time.AfterFunc(backoff, func() { t.resend(ctx, r) })
+}
+
+// resend sends the alerts waiting for retry unless a newer message of their
+// group was delivered meanwhile or a peer sent them. It does not wait for
+// the turn of replica again, the retries of replicas keep the order of
+// their first attempts.
+func (t *target) resend(ctx context.Context, r *retrying) {
+	t.mtx.Lock()
+	rs := t.retries[r.msg.groupKey]
+	for i := range rs {
+		if rs[i] == r {
+			rs = append(rs[:i], rs[i+1:]...)
+			break
+		}
+	}
+	if len(rs) == 0 {
+		delete(t.retries, r.msg.groupKey)
+	} else {
+		t.retries[r.msg.groupKey] = rs
+	}
+	superseded := r.superseded
+	t.mtx.Unlock()
+
+	if superseded {
+		t.dropRetry(ctx, r, "superseded")
+		return
+	}
+
+	alerts := t.cluster.Unsent(ctx, t.conf.Name, r.alerts)
+	if len(alerts) == 0 {
+		r.release()
+		return
+	}
+
+	resp, failed, err := t.sendAll(ctx, alerts)
+	if err != nil && resp.Retryable {
+		r.alerts = failed
+		t.retryLater(ctx, r)
+		return
+	}
+	if err != nil {
+		log.S(ctx).Errorf("failed to resend alerting %s to %s: %v", jsonMarshal(alerts), t.conf.Name, err)
+	}
+	r.release()
+}
+
+// dropRetry gives up the alerts waiting for retry.
+func (t *target) dropRetry(ctx context.Context, r *retrying, reason string) {
+	log.S(ctx).Errorf("dropped alerting %s to %s after %d retries(%s)", jsonMarshal(r.alerts), t.conf.Name, r.attempts, reason)
+	droppedRetries.WithLabelValues(t.conf.Name, reason).Add(float64(len(r.alerts)))
+	if r.release != nil {
+		r.release()
+	}
+}
+
+// supersede marks the retries of the messages of group received before msg,
+// so the older status does not overwrite the delivered one.
+func (t *target) supersede(msg message) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for _, r := range t.retries[msg.groupKey] {
+		if r.msg.received.Before(msg.received) {
+			r.superseded = true
+		}
+	}
+}
+
+// sendBatch sends the alerts to sink, the retryable failures are retried.
+func (t *target) sendBatch(ctx context.Context, alerts converter.AIOPAlerts) (sink.Result, error) {
+	backoff := retryBackoff
+	for i := 0; ; i++ {
+		res, err := t.sink.Send(ctx, alerts)
+		if err == nil {
+			t.observe(res.Status/100 == 2)
+			for _, r := range res.Rejected {
+				log.S(ctx).Warnf("alerting %d rejected by %s: %s", r.ID, t.conf.Name, r.Reason)
+			}
+			rejectedAlerts.WithLabelValues(t.conf.Name).Add(float64(len(res.Rejected)))
+			return res, nil
+		}
+		t.observe(false)
+
+		if !sink.IsRetryable(err) || i >= maxRetries {
+			return res, err
+		}
+
+		log.S(ctx).Warnf("failed to send %d alerts to %s, retrying in %s: %v", len(alerts), t.conf.Name, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return res, err
+		}
+		backoff *= 2
+	}
+}
+
+// observe records the outcome of delivery to AIOP, the other targets do not
+// affect readiness.
+func (t *target) observe(success bool) {
+	if t.conf.Type == config.TargetAIOP {
+		t.deliveries.Observe(success)
+	}
+}
+
+// accepted returns the alerts not rejected.
+func accepted(alerts converter.AIOPAlerts, rejected []sink.Rejection) converter.AIOPAlerts {
+	if len(rejected) == 0 {
+		return alerts
+	}
+
+	ids := map[uint32]bool{}
+	for _, r := range rejected {
+		ids[r.ID] = true
+	}
+
+	res := make(converter.AIOPAlerts, 0, len(alerts))
+	for _, a := range alerts {
+		if !ids[a.ID] {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// sendHeldDown posts the RESOLVED alerts whose hold-down expired, the turn
+// of replica is measured from now, as the peers release them at the same
+// time.
+func (t *target) sendHeldDown(ctx context.Context, alerts converter.AIOPAlerts) {
+	ctx = cluster.WithReceived(ctx, time.Now())
+	if _, err := t.send(ctx, alerts); err != nil {
+		log.S(ctx).Errorf("failed to send held down alerting %s to %s: %v", jsonMarshal(alerts), t.conf.Name, err)
+	}
+}
+
+// sendWaited posts the alerts not sent by peers in the turn of replica.
+func (t *target) sendWaited(ctx context.Context, alerts converter.AIOPAlerts) {
+	if _, err := t.deliver(ctx, alerts); err != nil {
+		log.S(ctx).Errorf("failed to send alerting %s to %s after waiting for peers: %v", jsonMarshal(alerts), t.conf.Name, err)
+	}
+}
+
+func (t *target) response(status int, message string) PostResponse {
+	return PostResponse{Target: t.conf.Name, WebhookURL: t.conf.URL, Status: status, Message: message}
+}
@@ -0,0 +1,278 @@
+package silence
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// retention is how long expired silences are kept.
+const retention = 120 * time.Hour
+
+var (
+	// ErrNotFound is returned when silence does not exist.
+	ErrNotFound = errors.New("silence not found")
+	// ErrPersist is returned when silences could not be saved, the change
+	// is rolled back.
+	ErrPersist = errors.New("failed to persist silences")
+)
+
+// Silence state
+const (
+	StateActive  = "active"
+	StatePending = "pending"
+	StateExpired = "expired"
+)
+
+// Silence suppresses notifications of alerts match all of its matchers
+// between StartsAt and EndsAt.
+type Silence struct {
+	ID string `json:"id"`
+	// Matchers are label matchers like `datacenter="mumbai"` or `alertname=~"Node.*"`
+	Matchers  []string  `json:"matchers"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+	State     string    `json:"state,omitempty"`
+
+	matchers []*labels.Matcher
+}
+
+// Validate checks the silence and parses its matchers.
+func (s *Silence) Validate() error {
+	if len(s.Matchers) == 0 {
+		return errors.New("at least one matcher required")
+	}
+
+	s.matchers = s.matchers[:0]
+	for _, m := range s.Matchers {
+		matcher, err := labels.ParseMatcher(m)
+		if err != nil {
+			return fmt.Errorf("invalid matcher %q: %w", m, err)
+		}
+		s.matchers = append(s.matchers, matcher)
+	}
+
+	if s.StartsAt.IsZero() {
+		return errors.New("invalid zero start timestamp")
+	}
+	if s.EndsAt.IsZero() {
+		return errors.New("invalid zero end timestamp")
+	}
+	if s.EndsAt.Before(s.StartsAt) {
+		return errors.New("end time must not be before start time")
+	}
+
+	return nil
+}
+
+// Matches returns whether the silence matches the labels.
+func (s *Silence) Matches(ls template.KV) bool {
+	for _, m := range s.matchers {
+		if !m.Matches(ls[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Silence) state(now time.Time) string {
+	if now.Before(s.StartsAt) {
+		return StatePending
+	}
+	if now.Before(s.EndsAt) {
+		return StateActive
+	}
+	return StateExpired
+}
+
+// Silences holds the silences and persists them to a file.
+type Silences struct {
+	path string
+
+	mtx sync.RWMutex
+	sil map[string]*Silence
+}
+
+// New creates a Silences object and loads the silences from path if exists.
+func New(path string) (*Silences, error) {
+	s := &Silences{path: path, sil: map[string]*Silence{}}
+
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sils []*Silence
+	if err := json.Unmarshal(buf, &sils); err != nil {
+		return nil, fmt.Errorf("failed to load silences from %s: %w", path, err)
+	}
+	for _, sil := range sils {
+		if err := sil.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid silence %s: %w", sil.ID, err)
+		}
+		s.sil[sil.ID] = sil
+	}
+
+	return s, nil
+}
+
+// Create adds a new silence and returns its id.
+func (s *Silences) Create(sil Silence) (string, error) {
+	now := time.Now()
+	if sil.StartsAt.IsZero() || sil.StartsAt.Before(now) {
+		sil.StartsAt = now
+	}
+	if err := sil.Validate(); err != nil {
+		return "", err
+	}
+	if !sil.EndsAt.After(now) {
+		return "", errors.New("end time must be in the future")
+	}
+
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	sil.ID, sil.State = id, ""
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.sil[id] = &sil
+	if err := s.persist(); err != nil {
+		delete(s.sil, id)
+		return "", err
+	}
+	return id, nil
+}
+
+// Expire ends the silence now.
+func (s *Silences) Expire(id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	sil, ok := s.sil[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	if sil.state(now) == StateExpired {
+		return nil
+	}
+	prev := *sil
+	if now.Before(sil.StartsAt) {
+		sil.StartsAt = now
+	}
+	sil.EndsAt = now
+
+	if err := s.persist(); err != nil {
+		*sil = prev
+		return err
+	}
+	return nil
+}
+
+// List returns all silences ordered by start time.
+func (s *Silences) List() []Silence {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := time.Now()
+	s.gc(now)
+
+	res := make([]Silence, 0, len(s.sil))
+	for _, sil := range s.sil {
+		cp := *sil
+		cp.State = sil.state(now)
+		res = append(res, cp)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].StartsAt.Before(res[j].StartsAt) })
+
+	return res
+}
+
+// Mutes returns the id of the active silence which matches the labels.
+func (s *Silences) Mutes(ls template.KV) (string, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	now := time.Now()
+	for id, sil := range s.sil {
+		if sil.state(now) == StateActive && sil.Matches(ls) {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+// gc removes the silences expired longer than retention.
+func (s *Silences) gc(now time.Time) {
+	var changed bool
+	for id, sil := range s.sil {
+		if now.Sub(sil.EndsAt) > retention {
+			delete(s.sil, id)
+			changed = true
+		}
+	}
+
+	if changed {
+		s.persist()
+	}
+}
+
+// persist writes silences to a temporary file and renames it to path, the
+// errors wrap ErrPersist.
+func (s *Silences) persist() error {
+	if err := s.write(); err != nil {
+		return fmt.Errorf("%w: %v", ErrPersist, err)
+	}
+	return nil
+}
+
+func (s *Silences) write() error {
+	sils := make([]*Silence, 0, len(s.sil))
+	for _, sil := range s.sil {
+		sils = append(sils, sil)
+	}
+
+	buf, err := json.Marshal(sils)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
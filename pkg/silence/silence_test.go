@@ -0,0 +1,104 @@
+package silence
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestSilences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "silence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "silences.json")
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Create(Silence{Matchers: []string{`region="AP2"`}, EndsAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(Silence{Matchers: []string{`datacenter="mumbai"`, `alertname=~"Node.*"`}}); err == nil {
+		t.Error("expected error for silence without end time")
+	}
+
+	id, err := s.Create(Silence{
+		Matchers: []string{`datacenter="mumbai"`, `alertname=~"Node.*"`},
+		EndsAt:   time.Now().Add(time.Hour),
+		Comment:  "planned maintenance",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ls := template.KV{"alertname": "NodeDown", "datacenter": "mumbai"}
+	if sid, ok := s.Mutes(ls); !ok || sid != id {
+		t.Errorf("expected alert muted by %s, but got %s %v", id, sid, ok)
+	}
+	if _, ok := s.Mutes(template.KV{"alertname": "NodeDown", "datacenter": "lax"}); ok {
+		t.Error("expected alert not muted")
+	}
+
+	// silences survive a restart
+	s, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.List()) != 2 {
+		t.Errorf("expected 2 silences loaded, but got %d", len(s.List()))
+	}
+
+	if err := s.Expire(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Mutes(ls); ok {
+		t.Error("expected alert not muted by expired silence")
+	}
+	if err := s.Expire("unknown"); err != ErrNotFound {
+		t.Errorf("expected %v, but got %v", ErrNotFound, err)
+	}
+}
+
+func TestSilencesPersistFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "silence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := New(filepath.Join(dir, "silences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := s.Create(Silence{Matchers: []string{`region="AP2"`}, EndsAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the parent of path is a regular file, so writes fail
+	s.path = filepath.Join(dir, "silences.json", "silences.json")
+
+	ls := template.KV{"region": "AP2", "alertname": "NodeDown"}
+	if err := s.Expire(id); !errors.Is(err, ErrPersist) {
+		t.Errorf("expected %v, but got %v", ErrPersist, err)
+	}
+	if _, ok := s.Mutes(ls); !ok {
+		t.Error("expected expiration rolled back")
+	}
+
+	if _, err := s.Create(Silence{Matchers: []string{`region="AP1"`}, EndsAt: time.Now().Add(time.Hour)}); !errors.Is(err, ErrPersist) {
+		t.Errorf("expected %v, but got %v", ErrPersist, err)
+	}
+	if n := len(s.List()); n != 1 {
+		t.Errorf("expected unsaved silence rolled back, but got %d silences", n)
+	}
+}
@@ -0,0 +1,61 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/aiop"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/tracing"
+)
+
+// aiopSink posts {"alerts": AIOPAlerts} to AIOP and interprets its response.
+type aiopSink struct {
+	conf   *config.TargetConfig
+	client *aiop.Client
+}
+
+func newAIOPSink(conf *config.TargetConfig) *aiopSink {
+	return &aiopSink{
+		conf:   conf,
+		client: aiop.NewClient(conf.URL, time.Duration(conf.Timeout), conf.Headers),
+	}
+}
+
+func (s *aiopSink) Send(ctx context.Context, alerts converter.AIOPAlerts) (_ Result, err error) {
+	ctx, span := tracing.Start(ctx, "aiop.request", tracing.WithKind(tracing.SpanKindClient))
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	span.SetAttribute("target", s.conf.Name)
+	span.SetAttribute("http.url", s.conf.URL)
+	span.SetAttribute("alerts", len(alerts))
+
+	res, err := s.client.Send(ctx, alerts)
+	span.SetAttribute("http.status_code", res.StatusCode)
+
+	result := Result{Status: res.StatusCode, Message: res.Body}
+	if err != nil {
+		retryable := true
+		if e := (*aiop.Error)(nil); errors.As(err, &e) {
+			retryable = e.Retryable
+		}
+		if res.StatusCode == 0 {
+			result.Message = err.Error()
+		}
+		return result, &Error{Err: err, Retryable: retryable}
+	}
+
+	log.S(ctx).Infof("send notification to aiop webhook(%s) status: %d, body: %s", s.conf.Name, res.StatusCode, res.Body)
+
+	if res.Response != nil {
+		for _, r := range res.Response.Rejected {
+			result.Rejected = append(result.Rejected, Rejection{ID: r.ID, Reason: r.Reason})
+		}
+	}
+	return result, nil
+}
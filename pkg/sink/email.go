@@ -0,0 +1,131 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+)
+
+// emailSink sends the alerts in a plain text email through SMTP.
+type emailSink struct {
+	conf *config.TargetConfig
+}
+
+func newEmailSink(conf *config.TargetConfig) *emailSink {
+	return &emailSink{conf: conf}
+}
+
+func (s *emailSink) Send(ctx context.Context, alerts converter.AIOPAlerts) (Result, error) {
+	ec := s.conf.Email
+	if err := s.sendMail(ctx, s.message(alerts)); err != nil {
+		// the 5xx replies are permanent
+		var te *textproto.Error
+		if errors.As(err, &te) {
+			return Result{Message: err.Error()}, &Error{Err: err, Retryable: te.Code/100 != 5}
+		}
+		return Result{Message: err.Error()}, err
+	}
+
+	return Result{Message: fmt.Sprintf("%d alerts mailed to %s", len(alerts), strings.Join(ec.To, ","))}, nil
+}
+
+// sendMail is smtp.SendMail bounded by the target timeout and ctx.
+func (s *emailSink) sendMail(ctx context.Context, msg []byte) error {
+	ec := s.conf.Email
+	timeout := time.Duration(s.conf.Timeout)
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", ec.Smarthost)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// a hung server is cut off once ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	host, _, _ := net.SplitHostPort(ec.Smarthost)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if ec.AuthUsername != "" {
+		if err := c.Auth(smtp.PlainAuth("", ec.AuthUsername, ec.AuthPassword, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(ec.From); err != nil {
+		return err
+	}
+	for _, to := range ec.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (s *emailSink) message(alerts converter.AIOPAlerts) []byte {
+	ec := s.conf.Email
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", ec.From)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(ec.To, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", ec.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: text/plain; charset=UTF-8\r\n")
+	fmt.Fprintf(buf, "Content-Transfer-Encoding: 8bit\r\n\r\n")
+
+	for _, a := range alerts {
+		fmt.Fprintf(buf, "[%s] %s level %d at %s\r\n", a.Status, a.Infor, a.Level, a.Time)
+		fmt.Fprintf(buf, "%s\r\n\r\n", a.Message)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,65 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+)
+
+// fileSink appends the alerts to a local file as JSON lines.
+type fileSink struct {
+	conf *config.TargetConfig
+	mtx  sync.Mutex
+}
+
+type fileRecord struct {
+	Target string    `json:"target"`
+	SentAt time.Time `json:"sentAt"`
+	converter.AIOPAlert
+}
+
+func newFileSink(conf *config.TargetConfig) *fileSink {
+	return &fileSink{conf: conf}
+}
+
+func (s *fileSink) Send(_ context.Context, alerts converter.AIOPAlerts) (_ Result, err error) {
+	// writing again does not help without permission
+	defer func() {
+		if errors.Is(err, os.ErrPermission) {
+			err = &Error{Err: err}
+		}
+	}()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.conf.Path), 0755); err != nil {
+		return Result{Message: err.Error()}, err
+	}
+
+	f, err := os.OpenFile(s.conf.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return Result{Message: err.Error()}, err
+	}
+	defer f.Close()
+
+	var (
+		now = time.Now()
+		enc = json.NewEncoder(f)
+	)
+	for _, a := range alerts {
+		if err := enc.Encode(fileRecord{Target: s.conf.Name, SentAt: now, AIOPAlert: a}); err != nil {
+			return Result{Message: err.Error()}, err
+		}
+	}
+
+	return Result{Message: fmt.Sprintf("%d alerts written to %s", len(alerts), s.conf.Path)}, f.Sync()
+}
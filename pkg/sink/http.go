@@ -0,0 +1,73 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/aiop"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/log"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/tracing"
+	"github.com/go-resty/resty/v2"
+)
+
+// httpSink posts the alerts in JSON to an URL.
+type httpSink struct {
+	conf   *config.TargetConfig
+	client *resty.Client
+	body   func(converter.AIOPAlerts) interface{}
+}
+
+// newWebhookSink creates a sink posts the alerts with the target name to a
+// generic JSON webhook.
+func newWebhookSink(conf *config.TargetConfig) *httpSink {
+	return newHTTPSink(conf, func(alerts converter.AIOPAlerts) interface{} {
+		return map[string]interface{}{"version": "1", "target": conf.Name, "alerts": alerts}
+	})
+}
+
+func newHTTPSink(conf *config.TargetConfig, body func(converter.AIOPAlerts) interface{}) *httpSink {
+	return &httpSink{
+		conf:   conf,
+		client: resty.New().SetTimeout(time.Duration(conf.Timeout)).SetHeaders(conf.Headers),
+		body:   body,
+	}
+}
+
+func (s *httpSink) Send(ctx context.Context, alerts converter.AIOPAlerts) (_ Result, err error) {
+	ctx, span := tracing.Start(ctx, s.conf.Type+".request", tracing.WithKind(tracing.SpanKindClient))
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	span.SetAttribute("target", s.conf.Name)
+	span.SetAttribute("http.url", s.conf.URL)
+	span.SetAttribute("alerts", len(alerts))
+
+	req := s.client.R().SetContext(ctx).EnableTrace().SetHeader("Content-Type", "application/json")
+	if id := log.RequestID(ctx); id != "" {
+		req.SetHeader(log.RequestIDHeader, id)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := req.SetBody(jsonMarshal(s.body(alerts))).Post(s.conf.URL)
+	if err != nil {
+		return Result{Message: err.Error()}, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode())
+
+	log.S(ctx).Infof("send notification to %s webhook(%s) status: %d, body: %s", s.conf.Type, s.conf.Name, resp.StatusCode(), resp.Body())
+	res := Result{Status: resp.StatusCode(), Message: string(resp.Body())}
+	if resp.StatusCode()/100 != 2 {
+		// classified as the AIOP responses
+		return res, &Error{
+			Err:       fmt.Errorf("%s webhook returned %d: %s", s.conf.Type, resp.StatusCode(), strings.TrimSpace(res.Message)),
+			Retryable: aiop.IsRetryableStatus(resp.StatusCode()),
+		}
+	}
+
+	return res, nil
+}
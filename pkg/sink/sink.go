@@ -0,0 +1,77 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+)
+
+// Result is the outcome of a delivery.
+type Result struct {
+	// Status is the HTTP status code if the sink speaks HTTP
+	Status  int
+	Message string
+	// Rejected are the alerts refused while the others were delivered
+	Rejected []Rejection
+}
+
+// Rejection is an alert the destination refused.
+type Rejection struct {
+	ID     uint32 `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// Error is a failed delivery.
+type Error struct {
+	Err error
+	// Retryable reports whether sending the same alerts again may succeed
+	Retryable bool
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether the delivery failed transiently, the errors
+// not classified by the sink are retryable.
+func IsRetryable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Retryable
+	}
+	return err != nil
+}
+
+// Sink delivers the converted alerts to a destination.
+type Sink interface {
+	Send(context.Context, converter.AIOPAlerts) (Result, error)
+}
+
+// New creates the Sink of target.
+func New(conf *config.TargetConfig) (Sink, error) {
+	switch conf.Type {
+	case config.TargetAIOP:
+		return newAIOPSink(conf), nil
+	case config.TargetWebhook:
+		return newWebhookSink(conf), nil
+	case config.TargetFile:
+		return newFileSink(conf), nil
+	case config.TargetEmail:
+		return newEmailSink(conf), nil
+	}
+
+	return nil, fmt.Errorf("unknown type %q of target %q", conf.Type, conf.Name)
+}
+
+func jsonMarshal(v interface{}) string {
+	buf, _ := json.Marshal(v)
+	return string(buf)
+}
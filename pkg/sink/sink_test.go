@@ -0,0 +1,241 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/config"
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/prometheus/common/model"
+)
+
+var testAlerts = converter.AIOPAlerts{
+	{ID: 1, Level: 2, Type: "ECN-CDN-NODE", Message: "[NodeDown] => 节点宕机", Infor: "ECN-CDN-NODE(10.0.0.1)", Status: "PROBLEM"},
+}
+
+func TestWebhookSink(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	conf := config.DefaultTargetConfig
+	conf.Name, conf.Type, conf.URL = "hook", config.TargetWebhook, srv.URL
+
+	s, err := New(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Send(context.Background(), testAlerts)
+	if err != nil || res.Status != http.StatusOK {
+		t.Fatalf("unexpected result %v %v", res, err)
+	}
+	if body["target"] != "hook" || len(body["alerts"].([]interface{})) != 1 {
+		t.Errorf("unexpected body %v", body)
+	}
+}
+
+func TestWebhookSinkStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status    int
+		err       bool
+		retryable bool
+	}{
+		{status: http.StatusAccepted},
+		{status: http.StatusBadRequest, err: true},
+		{status: http.StatusTooManyRequests, err: true, retryable: true},
+		{status: http.StatusBadGateway, err: true, retryable: true},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+		}))
+
+		conf := config.DefaultTargetConfig
+		conf.Name, conf.Type, conf.URL = "hook", config.TargetWebhook, srv.URL
+		s, err := New(&conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := s.Send(context.Background(), testAlerts)
+		srv.Close()
+
+		if res.Status != tc.status || (err != nil) != tc.err || (tc.err && IsRetryable(err) != tc.retryable) {
+			t.Errorf("status %d: unexpected result %v %v", tc.status, res, err)
+		}
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts", "alerts.jsonl")
+	conf := config.DefaultTargetConfig
+	conf.Name, conf.Type, conf.Path = "archive", config.TargetFile, path
+
+	s, err := New(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.Send(context.Background(), testAlerts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"target":"archive"`) {
+		t.Errorf("unexpected file content %s", content)
+	}
+}
+
+// serveSMTP accepts one SMTP session and returns the received data, the
+// recipients are answered with rcpt.
+func serveSMTP(t *testing.T, ln net.Listener, rcpt string) <-chan string {
+	data := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+
+		var body []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "RCPT"):
+				reply(rcpt)
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 end data with <CR><LF>.<CR><LF>")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					body = append(body, line)
+				}
+				reply("250 OK")
+				data <- strings.Join(body, "")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return data
+}
+
+func TestEmailSink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	data := serveSMTP(t, ln, "250 OK")
+
+	conf := config.DefaultTargetConfig
+	conf.Name, conf.Type = "mail", config.TargetEmail
+	conf.Email = &config.EmailConfig{Smarthost: ln.Addr().String(), From: "zenaiop@example.com", To: []string{"sre@example.com"}, Subject: "告警"}
+
+	s, err := New(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Send(context.Background(), testAlerts); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-data
+	if !strings.Contains(msg, "Subject: =?utf-8?q?") || !strings.Contains(msg, "[NodeDown] => 节点宕机") {
+		t.Errorf("unexpected email %s", msg)
+	}
+}
+
+func TestEmailSinkTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// the server accepts but never greets
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		ioutil.ReadAll(conn)
+	}()
+
+	conf := config.DefaultTargetConfig
+	conf.Name, conf.Type = "mail", config.TargetEmail
+	conf.Timeout = model.Duration(100 * time.Millisecond)
+	conf.Email = &config.EmailConfig{Smarthost: ln.Addr().String(), From: "zenaiop@example.com", To: []string{"sre@example.com"}}
+
+	s, err := New(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := s.Send(context.Background(), testAlerts); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("send took %s", d)
+	}
+}
+
+func TestEmailSinkRejected(t *testing.T) {
+	for _, tc := range []struct {
+		rcpt      string
+		retryable bool
+	}{
+		{rcpt: "550 mailbox unavailable", retryable: false},
+		{rcpt: "451 try again later", retryable: true},
+	} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		serveSMTP(t, ln, tc.rcpt)
+
+		conf := config.DefaultTargetConfig
+		conf.Name, conf.Type = "mail", config.TargetEmail
+		conf.Email = &config.EmailConfig{Smarthost: ln.Addr().String(), From: "zenaiop@example.com", To: []string{"sre@example.com"}}
+
+		s, err := New(&conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.Send(context.Background(), testAlerts)
+		if err == nil || IsRetryable(err) != tc.retryable {
+			t.Errorf("%s: expected error retryable %v, but got %v", tc.rcpt, tc.retryable, err)
+		}
+		ln.Close()
+	}
+}
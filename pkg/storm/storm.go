@@ -0,0 +1,261 @@
+package storm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// Options for the creation of an Aggregator object.
+type Options struct {
+	// Threshold is the number of alerts within Window above which alerts
+	// are collapsed, zero disables the aggregation.
+	Threshold int
+	Window    time.Duration
+	// GroupBy labels together with alertname identify a storm.
+	GroupBy []string
+	// Samples is the maximum number of affected resources in summary message.
+	Samples int
+	// TimeFormat formats the time of summary alerts
+	TimeFormat converter.TimeFormat
+}
+
+// Summary is an AIOP alert standing for a group of collapsed alerts.
+type Summary struct {
+	Alert  converter.AIOPAlert
+	Alerts converter.Alerts
+	// Partial is set when the alerts resolved while others of the storm
+	// still fire, the summary alert is not sent
+	Partial bool
+}
+
+// Aggregator collapses alerts storm into summary AIOP alerts.
+type Aggregator struct {
+	opts Options
+
+	mtx sync.Mutex
+	// seen holds the last arrival time of each alert fingerprint per group
+	seen map[string]map[string]time.Time
+	// storms holds the fingerprints of firing alerts collapsed into each
+	// summary id, the summary is resolved once all of them resolved
+	storms map[uint32]map[string]bool
+}
+
+// New creates an Aggregator object.
+func New(opts Options) *Aggregator {
+	groupBy := opts.GroupBy[:0:0]
+	for _, name := range opts.GroupBy {
+		if name = strings.TrimSpace(name); name != "" {
+			groupBy = append(groupBy, name)
+		}
+	}
+	opts.GroupBy = groupBy
+	if opts.TimeFormat.Layout == "" {
+		opts.TimeFormat = converter.DefaultTimeFormat
+	}
+
+	return &Aggregator{
+		opts:   opts,
+		seen:   map[string]map[string]time.Time{},
+		storms: map[uint32]map[string]bool{},
+	}
+}
+
+type group struct {
+	labels template.KV
+	status string
+	alerts converter.Alerts
+}
+
+// Aggregate returns the alerts which should be converted one by one and the
+// summaries of alerts belong to a storm. The resolved alerts of a storm are
+// collapsed until the last of them resolved, which resolves the summary.
+func (ag *Aggregator) Aggregate(alerts converter.Alerts) (converter.Alerts, []Summary) {
+	if ag.opts.Threshold <= 0 {
+		return alerts, nil
+	}
+
+	var (
+		keys   []string
+		groups = map[string]*group{}
+	)
+	for _, a := range alerts {
+		ls := template.KV{"alertname": a.Labels["alertname"]}
+		for _, name := range ag.opts.GroupBy {
+			ls[name] = a.Labels[name]
+		}
+
+		key := fmt.Sprintf("%d:%s", converter.FormatAIOPID(ls), a.Status)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{labels: ls, status: a.Status}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.alerts = append(g.alerts, a)
+	}
+
+	ag.mtx.Lock()
+	defer ag.mtx.Unlock()
+
+	var (
+		now       = time.Now()
+		passed    = converter.Alerts{}
+		summaries []Summary
+	)
+	for _, key := range keys {
+		var (
+			g     = groups[key]
+			id    = converter.FormatAIOPID(g.labels)
+			storm = ag.storms[id]
+			count = ag.observe(key, g.alerts, now)
+		)
+
+		// only the members of a tracked storm resolve with its summary, the
+		// others were sent one by one and are resolved so
+		if g.status == "resolved" && storm == nil {
+			passed = append(passed, g.alerts...)
+			continue
+		}
+		if g.status == "resolved" {
+			var members converter.Alerts
+			for _, a := range g.alerts {
+				if fp := fingerprint(a); storm[fp] {
+					delete(storm, fp)
+					members = append(members, a)
+				} else {
+					passed = append(passed, a)
+				}
+			}
+			if len(members) == 0 {
+				continue
+			}
+
+			if len(storm) != 0 {
+				summaries = append(summaries, Summary{Alert: converter.AIOPAlert{ID: id}, Alerts: members, Partial: true})
+				continue
+			}
+			delete(ag.storms, id)
+			rg := &group{labels: g.labels, status: g.status, alerts: members}
+			summaries = append(summaries, Summary{Alert: ag.summarize(rg, len(members)), Alerts: members})
+			continue
+		}
+
+		// the alerts firing while the storm lasts join it
+		if count <= ag.opts.Threshold && storm == nil {
+			passed = append(passed, g.alerts...)
+			continue
+		}
+
+		if storm == nil {
+			storm = map[string]bool{}
+			ag.storms[id] = storm
+		}
+		for _, a := range g.alerts {
+			storm[fingerprint(a)] = true
+		}
+		summaries = append(summaries, Summary{Alert: ag.summarize(g, count), Alerts: g.alerts})
+	}
+
+	return passed, summaries
+}
+
+// fingerprint identifies the alert, the AIOP id is used if Alertmanager did
+// not provide one.
+func fingerprint(a converter.Alert) string {
+	if a.Fingerprint != "" {
+		return a.Fingerprint
+	}
+	return fmt.Sprint(converter.AlertID(a))
+}
+
+// observe records the alerts of the group and returns the number of distinct
+// alerts seen within the window.
+func (ag *Aggregator) observe(key string, alerts converter.Alerts, now time.Time) int {
+	// forget the groups which are quiet for a whole window
+	for k, fps := range ag.seen {
+		for fp, t := range fps {
+			if now.Sub(t) > ag.opts.Window {
+				delete(fps, fp)
+			}
+		}
+		if len(fps) == 0 {
+			delete(ag.seen, k)
+		}
+	}
+
+	fps, ok := ag.seen[key]
+	if !ok {
+		fps = map[string]time.Time{}
+		ag.seen[key] = fps
+	}
+	for _, a := range alerts {
+		fps[fingerprint(a)] = now
+	}
+
+	return len(fps)
+}
+
+func (ag *Aggregator) summarize(g *group, count int) converter.AIOPAlert {
+	var (
+		typ     = "ECN-CDN-STORM"
+		level   = 0
+		first   = g.alerts[0]
+		endsAt  = first.EndsAt
+		samples []string
+		seen    = map[string]bool{}
+	)
+	for _, a := range g.alerts {
+		var resource string
+		if v, ok := a.Labels["address"]; ok {
+			typ, resource = "ECN-CDN-NODE", v
+		} else if v, ok := a.Labels["domain"]; ok {
+			typ, resource = "ECN-CDN-BIZ", v
+		}
+
+		if l := converter.FormatAIOPLevel(a.Labels["severity"]); l > level {
+			level = l
+		}
+		if a.StartsAt.Before(first.StartsAt) {
+			first = a
+		}
+		if a.EndsAt.After(endsAt) {
+			endsAt = a.EndsAt
+		}
+		if resource != "" && !seen[resource] {
+			seen[resource] = true
+			samples = append(samples, resource)
+		}
+	}
+
+	sort.Strings(samples)
+	affected := strings.Join(samples, ", ")
+	if ag.opts.Samples > 0 && len(samples) > ag.opts.Samples {
+		affected = strings.Join(samples[:ag.opts.Samples], ", ") + ", ..."
+	}
+
+	var scope []string
+	for _, name := range ag.opts.GroupBy {
+		scope = append(scope, fmt.Sprintf("%s=%s", name, g.labels[name]))
+	}
+
+	tm := ag.opts.TimeFormat.AlertTime(first.Alert)
+	if g.status == "resolved" && ag.opts.TimeFormat.ResolvedEndsAt && !endsAt.IsZero() {
+		tm = ag.opts.TimeFormat.Format(endsAt)
+	}
+
+	return converter.AIOPAlert{
+		ID:      converter.FormatAIOPID(g.labels),
+		Type:    typ,
+		Level:   level,
+		Time:    tm,
+		Message: fmt.Sprintf("[%s] => %d alerts within %s, affected: %s", g.labels["alertname"], count, ag.opts.Window, affected),
+		Infor:   fmt.Sprintf("%s(%s)", typ, strings.Join(scope, ",")),
+		Status:  converter.FormatAIOPStatus(g.status),
+	}
+}
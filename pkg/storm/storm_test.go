@@ -0,0 +1,130 @@
+package storm
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/feifeigood/prometheus-zenaiop/pkg/converter"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func nodeAlert(address, datacenter, status string) converter.Alert {
+	return converter.Alert{Alert: template.Alert{
+		Status: status,
+		Labels: template.KV{
+			"alertname":  "NodeDown",
+			"address":    address,
+			"datacenter": datacenter,
+			"severity":   "critical",
+		},
+		Fingerprint: address,
+		StartsAt:    time.Date(2020, 8, 13, 7, 35, 8, 0, time.UTC),
+	}}
+}
+
+func TestAggregate(t *testing.T) {
+	ag := New(Options{Threshold: 3, Window: time.Minute, GroupBy: []string{"datacenter"}, Samples: 2})
+
+	alerts := converter.Alerts{}
+	for i := 0; i < 4; i++ {
+		alerts = append(alerts, nodeAlert(fmt.Sprintf("10.0.0.%d", i), "mumbai", "firing"))
+	}
+	alerts = append(alerts, nodeAlert("10.0.1.1", "lax", "firing"))
+
+	passed, summaries := ag.Aggregate(alerts)
+	if len(passed) != 1 || passed[0].Labels["datacenter"] != "lax" {
+		t.Errorf("expected only lax alert passed, but got %v", passed)
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("expected 1 summary, but got %d", len(summaries))
+	}
+
+	s := summaries[0]
+	if len(s.Alerts) != 4 {
+		t.Errorf("expected 4 collapsed alerts, but got %d", len(s.Alerts))
+	}
+
+	want := "[NodeDown] => 4 alerts within 1m0s, affected: 10.0.0.0, 10.0.0.1, ..."
+	if s.Alert.Message != want {
+		t.Errorf("expected message %q, but got %q", want, s.Alert.Message)
+	}
+	if s.Alert.Type != "ECN-CDN-NODE" || s.Alert.Infor != "ECN-CDN-NODE(datacenter=mumbai)" || s.Alert.Level != 2 || s.Alert.Status != "PROBLEM" {
+		t.Errorf("unexpected summary %+v", s.Alert)
+	}
+
+	// repeated notification of a known alert keeps the storm
+	_, summaries = ag.Aggregate(converter.Alerts{nodeAlert("10.0.0.1", "mumbai", "firing")})
+	if len(summaries) != 1 {
+		t.Errorf("expected storm still active, but got %d summaries", len(summaries))
+	}
+}
+
+func TestAggregateDisabled(t *testing.T) {
+	ag := New(Options{})
+
+	alerts := converter.Alerts{nodeAlert("10.0.0.1", "mumbai", "firing"), nodeAlert("10.0.0.2", "mumbai", "firing")}
+	passed, summaries := ag.Aggregate(alerts)
+	if len(passed) != 2 || len(summaries) != 0 {
+		t.Errorf("expected alerts passed through, but got %v %v", passed, summaries)
+	}
+}
+
+func TestAggregatePartiallyResolved(t *testing.T) {
+	ag := New(Options{Threshold: 2, Window: time.Minute, GroupBy: []string{"datacenter"}})
+
+	alerts := converter.Alerts{}
+	for i := 0; i < 3; i++ {
+		alerts = append(alerts, nodeAlert(fmt.Sprintf("10.0.0.%d", i), "mumbai", "firing"))
+	}
+	_, summaries := ag.Aggregate(alerts)
+	if len(summaries) != 1 {
+		t.Fatalf("expected 1 summary, but got %d", len(summaries))
+	}
+	id := summaries[0].Alert.ID
+
+	// the storm still fires while some of its alerts resolve
+	passed, summaries := ag.Aggregate(converter.Alerts{
+		nodeAlert("10.0.0.0", "mumbai", "resolved"),
+		nodeAlert("10.0.1.1", "mumbai", "resolved"),
+	})
+	if len(passed) != 1 || passed[0].Fingerprint != "10.0.1.1" {
+		t.Errorf("expected only alert outside storm passed, but got %v", passed)
+	}
+	if len(summaries) != 1 || !summaries[0].Partial || len(summaries[0].Alerts) != 1 {
+		t.Fatalf("expected partial summary, but got %+v", summaries)
+	}
+
+	// the last resolved alerts resolve the summary
+	passed, summaries = ag.Aggregate(converter.Alerts{
+		nodeAlert("10.0.0.1", "mumbai", "resolved"),
+		nodeAlert("10.0.0.2", "mumbai", "resolved"),
+	})
+	if len(passed) != 0 || len(summaries) != 1 {
+		t.Fatalf("expected summary RESOLVED, but got %v %+v", passed, summaries)
+	}
+	if s := summaries[0]; s.Partial || s.Alert.ID != id || s.Alert.Status != "RESOLVED" {
+		t.Errorf("unexpected summary %+v", s.Alert)
+	}
+}
+
+func TestAggregateFiredApartResolvedTogether(t *testing.T) {
+	ag := New(Options{Threshold: 2, Window: 50 * time.Millisecond, GroupBy: []string{"datacenter"}})
+
+	var resolved converter.Alerts
+	for i := 0; i < 3; i++ {
+		a := nodeAlert(fmt.Sprintf("10.0.0.%d", i), "mumbai", "firing")
+		if passed, summaries := ag.Aggregate(converter.Alerts{a}); len(passed) != 1 || len(summaries) != 0 {
+			t.Fatalf("expected alert fired alone passed, but got %v %v", passed, summaries)
+		}
+		a.Status = "resolved"
+		resolved = append(resolved, a)
+		time.Sleep(60 * time.Millisecond)
+	}
+
+	// no storm was tracked, so the PROBLEMs sent one by one are resolved so
+	passed, summaries := ag.Aggregate(resolved)
+	if len(passed) != 3 || len(summaries) != 0 {
+		t.Errorf("expected 3 resolved alerts passed, but got %d passed and %d summaries", len(passed), len(summaries))
+	}
+}
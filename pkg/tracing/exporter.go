@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	exportedSpans = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "tracing",
+		Name:      "exported_spans_total",
+		Help:      "Total number of spans exported to the OTLP endpoint.",
+	})
+	droppedSpans = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "tracing",
+		Name:      "dropped_spans_total",
+		Help:      "Total number of spans dropped for a failed export.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(exportedSpans, droppedSpans)
+}
+
+// Options for the creation of a Tracer object.
+type Options struct {
+	// Endpoint is the OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces
+	Endpoint string
+	// ServiceName is the service.name resource attribute
+	ServiceName string
+	// Headers are added to the export requests
+	Headers map[string]string
+	// BatchTimeout is the maximum delay before the ended spans are exported
+	BatchTimeout time.Duration
+	// MaxQueueSize is the maximum number of spans waiting for export, the
+	// spans exceeding it are dropped
+	MaxQueueSize int
+	// MaxBatchSize is the maximum number of spans in an export request
+	MaxBatchSize int
+}
+
+// Tracer exports the ended spans in batches with the OTLP/HTTP exporter of
+// the OpenTelemetry SDK, encoded in protobuf.
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// New creates a Tracer and starts its exporter.
+func New(opts Options) (*Tracer, error) {
+	if opts.ServiceName == "" {
+		opts.ServiceName = "prometheus-zenaiop"
+	}
+
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", opts.Endpoint)
+	}
+
+	hopts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(u.Path),
+		otlptracehttp.WithHeaders(opts.Headers),
+	}
+	if u.Scheme == "http" {
+		hopts = append(hopts, otlptracehttp.WithInsecure())
+	}
+	exp, err := otlptracehttp.New(context.Background(), hopts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var bopts []sdktrace.BatchSpanProcessorOption
+	if opts.BatchTimeout > 0 {
+		bopts = append(bopts, sdktrace.WithBatchTimeout(opts.BatchTimeout))
+	}
+	if opts.MaxQueueSize > 0 {
+		bopts = append(bopts, sdktrace.WithMaxQueueSize(opts.MaxQueueSize))
+	}
+	if opts.MaxBatchSize > 0 {
+		bopts = append(bopts, sdktrace.WithMaxExportBatchSize(opts.MaxBatchSize))
+	}
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		zap.S().Warnf("failed to export spans to %s: %v", opts.Endpoint, err)
+	}))
+
+	provider := sdktrace.NewTracerProvider(
+		// the inbound traceparent is continued whatever its sampled flag
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", opts.ServiceName))),
+		sdktrace.WithBatcher(countingExporter{exp}, bopts...),
+	)
+
+	return &Tracer{
+		provider: provider,
+		tracer:   provider.Tracer("github.com/feifeigood/prometheus-zenaiop"),
+	}, nil
+}
+
+// Shutdown exports the queued spans and stops the exporter.
+func (t *Tracer) Shutdown() {
+	if err := t.provider.Shutdown(context.Background()); err != nil {
+		zap.S().Warnf("failed to shutdown tracer: %v", err)
+	}
+}
+
+// countingExporter counts the spans exported and the ones failed.
+type countingExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (e countingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if err := e.SpanExporter.ExportSpans(ctx, spans); err != nil {
+		droppedSpans.Add(float64(len(spans)))
+		return err
+	}
+	exportedSpans.Add(float64(len(spans)))
+	return nil
+}
@@ -0,0 +1,146 @@
+// Package tracing records the spans of webhook messages with the
+// OpenTelemetry SDK and exports them with its OTLP/HTTP exporter. The SDK is
+// pinned to v1.2.0, the last release supporting Go 1.15.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceparentHeader is the W3C trace context header.
+const TraceparentHeader = "traceparent"
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext = trace.SpanContext
+
+// SpanKind is the OTLP kind of span.
+type SpanKind = trace.SpanKind
+
+// Span kinds
+const (
+	SpanKindInternal = trace.SpanKindInternal
+	SpanKindServer   = trace.SpanKindServer
+	SpanKindClient   = trace.SpanKindClient
+)
+
+// StartOption configures a span when it starts.
+type StartOption = trace.SpanStartOption
+
+// WithKind sets the kind of span, it is internal by default.
+func WithKind(kind SpanKind) StartOption {
+	return trace.WithSpanKind(kind)
+}
+
+// Span is a timed operation of a trace, a nil Span records nothing so the
+// callers need not check whether tracing is enabled.
+type Span struct {
+	span trace.Span
+}
+
+// Context returns the span context.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.span.SpanContext()
+}
+
+// SetAttribute sets an attribute of span, value is string, bool, int or
+// float64.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	var kv attribute.KeyValue
+	switch v := value.(type) {
+	case bool:
+		kv = attribute.Bool(key, v)
+	case int:
+		kv = attribute.Int(key, v)
+	case float64:
+		kv = attribute.Float64(key, v)
+	default:
+		kv = attribute.String(key, fmt.Sprint(v))
+	}
+	s.span.SetAttributes(kv)
+}
+
+// SetError marks the span failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End finishes the span and queues it for export.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+var (
+	globalMtx sync.RWMutex
+	global    *Tracer
+)
+
+// SetTracer replaces the global tracer, nil disables tracing.
+func SetTracer(t *Tracer) {
+	globalMtx.Lock()
+	global = t
+	globalMtx.Unlock()
+}
+
+// Start starts a span as child of the span in context with the global
+// tracer, it returns a nil span when tracing is disabled.
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	globalMtx.RLock()
+	t := global
+	globalMtx.RUnlock()
+
+	if t == nil {
+		return ctx, nil
+	}
+
+	ctx, span := t.tracer.Start(ctx, name, opts...)
+	return ctx, &Span{span: span}
+}
+
+// SpanContextFromContext returns the span context of the current span or the
+// remote parent in context.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	return trace.SpanContextFromContext(ctx)
+}
+
+// ContextWithSpanContext returns a context whose spans are children of sc,
+// it carries the trace into a context not derived from the span's one.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+var propagator = propagation.TraceContext{}
+
+// Inject sets the traceparent header of the span in context.
+func Inject(ctx context.Context, h http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// Extract returns a context carries the remote parent in traceparent header,
+// an invalid header is ignored.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(h))
+}
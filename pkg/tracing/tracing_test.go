@@ -0,0 +1,145 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type collector struct {
+	*httptest.Server
+
+	mtx     sync.Mutex
+	service string
+	spans   map[string]*tracepb.Span
+}
+
+func newCollector() *collector {
+	c := &collector{spans: map[string]*tracepb.Span{}}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var req coltracepb.ExportTraceServiceRequest
+		if r.Header.Get("Content-Type") != "application/x-protobuf" || proto.Unmarshal(body, &req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, kv := range rs.Resource.Attributes {
+				if kv.Key == "service.name" {
+					c.service = kv.Value.GetStringValue()
+				}
+			}
+			for _, ils := range rs.InstrumentationLibrarySpans {
+				for _, s := range ils.Spans {
+					c.spans[s.Name] = s
+				}
+			}
+		}
+	}))
+	return c
+}
+
+func TestExport(t *testing.T) {
+	c := newCollector()
+	defer c.Close()
+
+	tracer, err := New(Options{Endpoint: c.URL + "/v1/traces"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	ctx, root := Start(context.Background(), "receive", WithKind(SpanKindServer))
+	_, child := Start(ctx, "convert")
+	child.SetAttribute("alerts", 3)
+	child.SetError(errors.New("boom"))
+	child.End()
+	root.End()
+
+	tracer.Shutdown()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(c.spans) != 2 || c.service != "prometheus-zenaiop" {
+		t.Fatalf("expected 2 spans of prometheus-zenaiop exported, but got %q %v", c.service, c.spans)
+	}
+	r, s := c.spans["receive"], c.spans["convert"]
+	if !bytes.Equal(s.TraceId, r.TraceId) || !bytes.Equal(s.ParentSpanId, r.SpanId) || len(r.ParentSpanId) != 0 {
+		t.Errorf("expected convert span child of receive span, but got %v %v", r, s)
+	}
+	if r.Kind != tracepb.Span_SPAN_KIND_SERVER || s.Kind != tracepb.Span_SPAN_KIND_INTERNAL {
+		t.Errorf("expected server and internal spans, but got %v %v", r.Kind, s.Kind)
+	}
+	if s.Status.Code != tracepb.Status_STATUS_CODE_ERROR || s.Status.Message != "boom" {
+		t.Errorf("unexpected status %v", s.Status)
+	}
+	if len(s.Attributes) != 1 || s.Attributes[0].Key != "alerts" || s.Attributes[0].Value.GetIntValue() != 3 {
+		t.Errorf("unexpected attributes %v", s.Attributes)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	tracer, err := New(Options{Endpoint: "http://127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetTracer(tracer)
+	defer tracer.Shutdown()
+	defer SetTracer(nil)
+
+	ctx, span := Start(context.Background(), "deliver")
+	h := http.Header{}
+	Inject(ctx, h)
+
+	sc := SpanContextFromContext(Extract(context.Background(), h))
+	if sc.TraceID() != span.Context().TraceID() || sc.SpanID() != span.Context().SpanID() {
+		t.Errorf("expected %+v extracted from %q, but got %+v", span.Context(), h.Get(TraceparentHeader), sc)
+	}
+}
+
+func TestExtractInvalid(t *testing.T) {
+	for _, tp := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"0g-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00F067AA0BA902B7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0X",
+	} {
+		h := http.Header{}
+		h.Set(TraceparentHeader, tp)
+		if sc := SpanContextFromContext(Extract(context.Background(), h)); sc.IsValid() {
+			t.Errorf("expected %q rejected, but got %+v", tp, sc)
+		}
+	}
+
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if sc := SpanContextFromContext(Extract(context.Background(), h)); sc.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected valid traceparent extracted, but got %+v", sc)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "noop")
+	span.SetAttribute("k", "v")
+	span.End()
+
+	if SpanContextFromContext(ctx).IsValid() {
+		t.Errorf("expected no span without tracer")
+	}
+}
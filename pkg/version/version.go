@@ -1,7 +1,57 @@
 package version
 
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
 // build metadata
 var (
 	VERSION   = "dev"
+	REVISION  = "unknow"
+	BRANCH    = "unknow"
+	BUILDUSER = "unknow"
 	BUILDDATE = "unknow"
+	GOVERSION = runtime.Version()
 )
+
+// BuildInfo is the build metadata of running program.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Branch    string `json:"branch"`
+	BuildUser string `json:"buildUser"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Info returns the build metadata.
+func Info() BuildInfo {
+	return BuildInfo{
+		Version:   VERSION,
+		Revision:  REVISION,
+		Branch:    BRANCH,
+		BuildUser: BUILDUSER,
+		BuildDate: BUILDDATE,
+		GoVersion: GOVERSION,
+	}
+}
+
+// Print returns the build metadata in human readable form.
+func Print(program string) string {
+	return fmt.Sprintf("%s, version %s (branch: %s, revision: %s)\n  build user:  %s\n  build date:  %s\n  go version:  %s",
+		program, VERSION, BRANCH, REVISION, BUILDUSER, BUILDDATE, GOVERSION)
+}
+
+func init() {
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "prometheus_zenaiop",
+		Name:      "build_info",
+		Help:      "A metric with a constant '1' value labeled by version, revision, branch, build user, build date and goversion from which prometheus-zenaiop was built.",
+	}, []string{"version", "revision", "branch", "builduser", "builddate", "goversion"})
+	buildInfo.WithLabelValues(VERSION, REVISION, BRANCH, BUILDUSER, BUILDDATE, GOVERSION).Set(1)
+
+	prometheus.MustRegister(buildInfo)
+}
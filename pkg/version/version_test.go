@@ -0,0 +1,37 @@
+package version
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBuildInfoMetric(t *testing.T) {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mf := range mfs {
+		if mf.GetName() != "prometheus_zenaiop_build_info" {
+			continue
+		}
+		labels := map[string]string{}
+		for _, lp := range mf.GetMetric()[0].GetLabel() {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		if labels["version"] != VERSION || labels["goversion"] != GOVERSION {
+			t.Errorf("unexpected build info labels %v", labels)
+		}
+		return
+	}
+
+	t.Errorf("build info metric not registered")
+}
+
+func TestPrint(t *testing.T) {
+	if s := Print("prometheus-zenaiop"); !strings.HasPrefix(s, "prometheus-zenaiop, version dev") {
+		t.Errorf("unexpected version %q", s)
+	}
+}
@@ -0,0 +1,383 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var (
+	pendingRecords = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "wal",
+		Name:      "pending_entries",
+		Help:      "Number of entries in write-ahead log not delivered yet.",
+	})
+	corruptions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "wal",
+		Name:      "corruptions_total",
+		Help:      "Total number of corrupted write-ahead log segments truncated.",
+	})
+	segments = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "prometheus_zenaiop",
+		Subsystem: "wal",
+		Name:      "segments",
+		Help:      "Number of write-ahead log segment files.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(pendingRecords, corruptions, segments)
+}
+
+const (
+	recordEntry byte = 1
+	recordDone  byte = 2
+
+	// headerSize is the length and the checksum of record
+	headerSize = 8
+	// maxRecordSize rejects the garbage length of corrupted records
+	maxRecordSize = 64 << 20
+
+	// DefaultSegmentSize is the size above which a new segment is started.
+	DefaultSegmentSize = 16 << 20
+)
+
+var (
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+	// ErrClosed is returned when appending to a closed WAL.
+	ErrClosed  = errors.New("wal is closed")
+	errCorrupt = errors.New("corrupted record")
+)
+
+// Entry is a record of WAL not marked done.
+type Entry struct {
+	ID   uint64
+	Data []byte
+}
+
+// WAL is an append only log of entries which are marked done once handled.
+// Each record is framed as
+//
+//	length(4) | crc32c(4) | type(1) | id(8) | data(length)
+//
+// in numbered segment files, a segment is removed once all of its entries
+// are done.
+type WAL struct {
+	dir         string
+	segmentSize int64
+
+	mtx     sync.Mutex
+	closed  bool
+	nextID  uint64
+	seg     int
+	file    *os.File
+	size    int64
+	entries map[uint64]int // pending entry id to its segment
+	pending map[int]int    // pending entries per segment
+}
+
+// Open opens the WAL in dir and returns the entries not marked done in the
+// order appended. The corrupted tail of segments is truncated.
+func Open(dir string, segmentSize int64) (*WAL, []Entry, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	w := &WAL{
+		dir:         dir,
+		segmentSize: segmentSize,
+		nextID:      1,
+		entries:     map[uint64]int{},
+		pending:     map[int]int{},
+	}
+
+	segs, err := w.segments()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		data  = map[uint64][]byte{}
+		order []uint64
+	)
+	for _, seg := range segs {
+		w.pending[seg] = 0
+		err := w.replay(seg, func(typ byte, id uint64, b []byte) {
+			if id >= w.nextID {
+				w.nextID = id + 1
+			}
+			switch typ {
+			case recordEntry:
+				w.entries[id] = seg
+				w.pending[seg]++
+				data[id] = b
+				order = append(order, id)
+			case recordDone:
+				if s, ok := w.entries[id]; ok {
+					delete(w.entries, id)
+					w.pending[s]--
+				}
+			}
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		w.seg = seg
+	}
+
+	var pending []Entry
+	for _, id := range order {
+		if _, ok := w.entries[id]; ok {
+			pending = append(pending, Entry{ID: id, Data: data[id]})
+		}
+	}
+
+	// new records go to a fresh segment, the replayed ones are removed
+	// once their entries are done
+	if err := w.cut(); err != nil {
+		return nil, nil, err
+	}
+	pendingRecords.Set(float64(len(w.entries)))
+
+	return w, pending, nil
+}
+
+// Append writes the data as an entry and syncs it to disk.
+func (w *WAL) Append(data []byte) (uint64, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	if w.size >= w.segmentSize {
+		if err := w.cut(); err != nil {
+			return 0, err
+		}
+	}
+
+	id := w.nextID
+	if err := w.write(recordEntry, id, data); err != nil {
+		return 0, err
+	}
+	if err := w.file.Sync(); err != nil {
+		return 0, err
+	}
+
+	w.nextID++
+	w.entries[id] = w.seg
+	w.pending[w.seg]++
+	pendingRecords.Inc()
+
+	return id, nil
+}
+
+// Done marks the entry handled, it is not returned by Open anymore.
+func (w *WAL) Done(id uint64) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.closed {
+		return ErrClosed
+	}
+
+	seg, ok := w.entries[id]
+	if !ok {
+		return nil
+	}
+
+	// losing a done record only replays a handled entry again, so it is
+	// not synced
+	if err := w.write(recordDone, id, nil); err != nil {
+		return err
+	}
+
+	delete(w.entries, id)
+	w.pending[seg]--
+	pendingRecords.Dec()
+	w.gc()
+
+	return nil
+}
+
+// Close syncs and closes the current segment.
+func (w *WAL) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+func (w *WAL) write(typ byte, id uint64, data []byte) error {
+	buf := make([]byte, headerSize+9+len(data))
+	binary.BigEndian.PutUint32(buf[0:], uint32(len(data)))
+	buf[8] = typ
+	binary.BigEndian.PutUint64(buf[9:], id)
+	copy(buf[17:], data)
+	binary.BigEndian.PutUint32(buf[4:], crc32.Checksum(buf[8:], castagnoli))
+
+	n, err := w.file.Write(buf)
+	w.size += int64(n)
+	if err != nil {
+		// drop the partial record, replay would see it as corruption
+		if terr := w.file.Truncate(w.size - int64(n)); terr == nil {
+			w.size -= int64(n)
+		}
+	}
+	return err
+}
+
+// cut closes the current segment and starts a new one.
+func (w *WAL) cut() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		defer w.gc()
+	}
+
+	w.seg++
+	f, err := os.OpenFile(w.segmentPath(w.seg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.file, w.size = f, 0
+	w.pending[w.seg] = 0
+	segments.Set(float64(len(w.pending)))
+
+	return nil
+}
+
+// gc removes the oldest segments without pending entries. A segment is only
+// removed after the older ones, so the done records of pending entries in
+// older segments are kept.
+func (w *WAL) gc() {
+	segs := make([]int, 0, len(w.pending))
+	for seg := range w.pending {
+		segs = append(segs, seg)
+	}
+	sort.Ints(segs)
+
+	for _, seg := range segs {
+		if seg == w.seg || w.pending[seg] > 0 {
+			break
+		}
+		if err := os.Remove(w.segmentPath(seg)); err != nil && !os.IsNotExist(err) {
+			zap.S().Errorf("failed to remove wal segment %d: %v", seg, err)
+			break
+		}
+		delete(w.pending, seg)
+	}
+	segments.Set(float64(len(w.pending)))
+}
+
+// replay reads the records of segment, the segment is truncated at the
+// first corrupted record.
+func (w *WAL) replay(seg int, fn func(typ byte, id uint64, data []byte)) error {
+	path := w.segmentPath(seg)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		r      = bufio.NewReader(f)
+		offset int64
+	)
+	for {
+		typ, id, data, n, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			zap.S().Warnf("wal segment %s corrupted at offset %d, truncating: %v", path, offset, err)
+			corruptions.Inc()
+			return os.Truncate(path, offset)
+		}
+		fn(typ, id, data)
+		offset += n
+	}
+}
+
+func readRecord(r io.Reader) (typ byte, id uint64, data []byte, n int64, err error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("%w: torn header", errCorrupt)
+		}
+		return 0, 0, nil, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:])
+	if length > maxRecordSize {
+		return 0, 0, nil, 0, fmt.Errorf("%w: invalid length %d", errCorrupt, length)
+	}
+
+	body := make([]byte, 9+length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, 0, fmt.Errorf("%w: torn record: %v", errCorrupt, err)
+	}
+	if crc32.Checksum(body, castagnoli) != binary.BigEndian.Uint32(header[4:]) {
+		return 0, 0, nil, 0, fmt.Errorf("%w: checksum mismatch", errCorrupt)
+	}
+
+	typ = body[0]
+	if typ != recordEntry && typ != recordDone {
+		return 0, 0, nil, 0, fmt.Errorf("%w: unknown type %d", errCorrupt, typ)
+	}
+
+	return typ, binary.BigEndian.Uint64(body[1:]), body[9:], int64(headerSize + len(body)), nil
+}
+
+func (w *WAL) segmentPath(seg int) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%08d", seg))
+}
+
+// segments returns the segment numbers in dir in ascending order.
+func (w *WAL) segments() ([]int, error) {
+	files, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segs []int
+	for _, fi := range files {
+		seg, err := strconv.Atoi(fi.Name())
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		segs = append(segs, seg)
+	}
+	sort.Ints(segs)
+
+	return segs, nil
+}
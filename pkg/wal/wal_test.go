@@ -0,0 +1,163 @@
+package wal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func appendAll(t *testing.T, w *WAL, data ...string) []uint64 {
+	var ids []uint64
+	for _, d := range data {
+		id, err := w.Append([]byte(d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func entryData(entries []Entry) []string {
+	var res []string
+	for _, e := range entries {
+		res = append(res, string(e.Data))
+	}
+	return res
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	w, pending, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending entries, but got %v", pending)
+	}
+
+	ids := appendAll(t, w, "a", "b", "c")
+	if err := w.Done(ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	w, pending, err = Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(want, entryData(pending)) {
+		t.Fatalf("expected %v, but got %v", want, entryData(pending))
+	}
+
+	// ids keep increasing across restarts
+	id := appendAll(t, w, "d")[0]
+	if id <= ids[2] {
+		t.Errorf("expected id above %d, but got %d", ids[2], id)
+	}
+
+	for _, e := range pending {
+		w.Done(e.ID)
+	}
+	w.Done(id)
+	w.Close()
+
+	_, pending, err = Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected all entries done, but got %v", entryData(pending))
+	}
+}
+
+func TestSegmentRemoval(t *testing.T) {
+	dir := t.TempDir()
+
+	w, _, err := Open(dir, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := appendAll(t, w, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "b", "c", "d", "e")
+	for _, id := range ids[1:] {
+		w.Done(id)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) < 2 {
+		t.Fatalf("expected the oldest segment kept for pending entry, but got %d files", len(files))
+	}
+
+	w.Done(ids[0])
+	files, _ = ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("expected only current segment left, but got %d files", len(files))
+	}
+	w.Close()
+}
+
+func TestCorruption(t *testing.T) {
+	dir := t.TempDir()
+
+	w, _, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendAll(t, w, "a", "b", "c")
+	w.Close()
+
+	path := filepath.Join(dir, "00000001")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flip a byte of the second record
+	rec := headerSize + 9 + 1
+	b[rec+headerSize+9] ^= 0xff
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, pending, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(want, entryData(pending)) {
+		t.Errorf("expected %v before corruption, but got %v", want, entryData(pending))
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(rec) {
+		t.Errorf("expected segment truncated to %d bytes, but got %d", rec, fi.Size())
+	}
+}
+
+func TestTornWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	w, _, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendAll(t, w, "a", "b")
+	w.Close()
+
+	path := filepath.Join(dir, "00000001")
+	fi, _ := os.Stat(path)
+	os.Truncate(path, fi.Size()-3)
+
+	_, pending, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(want, entryData(pending)) {
+		t.Errorf("expected %v, but got %v", want, entryData(pending))
+	}
+}